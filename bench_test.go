@@ -0,0 +1,136 @@
+package excelinspect
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var benchParts = map[string]string{
+	"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/><Override PartName="/xl/sharedStrings.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sharedStrings+xml"/></Types>`,
+	"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`,
+	"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Inventory" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+	"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/><Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/></Relationships>`,
+	"xl/styles.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="1"><fill><patternFill patternType="none"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs></styleSheet>`,
+}
+
+var benchHeaders = []string{"NO", "STATUS", "PLATE NO", "MERK", "TYPE", "YEAR", "COLOR", "ODOMETER", "PURCHASE DATE", "CASH PRICE"}
+
+var benchStrings = []string{"READY", "SOLD", "TOYOTA", "HONDA", "DAIHATSU", "Avanza", "Jazz", "Xenia", "Red", "Black", "White", "INVENTORY REPORT"}
+
+// benchWorkbook returns an .xlsx inventory report with a title row, a bold
+// header row and n data rows.
+func benchWorkbook(tb testing.TB, n int) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		io.WriteString(w, benchParts[name])
+	}
+
+	w, err := zw.Create("xl/sharedStrings.xml")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"+`<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="%d" uniqueCount="%d">`, len(benchStrings), len(benchStrings))
+	for _, s := range benchStrings {
+		fmt.Fprintf(w, "<si><t>%s</t></si>", s)
+	}
+	io.WriteString(w, "</sst>")
+
+	w, err = zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><dimension ref="A1:J%d"/><sheetData>`, n+2)
+	fmt.Fprintf(bw, `<row r="1"><c r="A1" t="s"><v>11</v></c></row><row r="2">`)
+	for col, h := range benchHeaders {
+		fmt.Fprintf(bw, `<c r="%c2" s="2" t="inlineStr"><is><t>%s</t></is></c>`, 'A'+col, h)
+	}
+	bw.WriteString("</row>")
+	for row := 3; row < n+3; row++ {
+		k := row - 3
+		fmt.Fprintf(bw, `<row r="%d">`, row)
+		fmt.Fprintf(bw, `<c r="A%d"><v>%d</v></c>`, row, k+1)
+		fmt.Fprintf(bw, `<c r="B%d" t="s"><v>%d</v></c>`, row, k%2)
+		fmt.Fprintf(bw, `<c r="C%d" t="inlineStr"><is><t>B%04dXX</t></is></c>`, row, k%10000)
+		fmt.Fprintf(bw, `<c r="D%d" t="s"><v>%d</v></c>`, row, 2+k%3)
+		fmt.Fprintf(bw, `<c r="E%d" t="s"><v>%d</v></c>`, row, 5+k%3)
+		fmt.Fprintf(bw, `<c r="F%d"><v>%d</v></c>`, row, 2010+k%15)
+		if k%7 != 0 {
+			fmt.Fprintf(bw, `<c r="G%d" t="s"><v>%d</v></c>`, row, 8+k%3)
+		}
+		fmt.Fprintf(bw, `<c r="H%d"><v>%d</v></c>`, row, (k%200)*1000)
+		fmt.Fprintf(bw, `<c r="I%d" s="1"><v>%d</v></c>`, row, 45000+k%900)
+		fmt.Fprintf(bw, `<c r="J%d"><v>%d</v></c>`, row, 150000000+k*1000)
+		bw.WriteString("</row>")
+	}
+	bw.WriteString("</sheetData></worksheet>")
+	if err := bw.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// benchInspect opens a 100,000-row workbook held in memory b.N times and
+// runs inspect on it.
+func benchInspect(b *testing.B, inspect func(*Inspector) error) {
+	data := benchWorkbook(b, 100000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		ins, err := NewFromBytes(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := inspect(ins); err != nil {
+			b.Fatal(err)
+		}
+		ins.Close()
+	}
+}
+
+func BenchmarkInspect(b *testing.B) {
+	benchInspect(b, func(ins *Inspector) error {
+		_, err := ins.Inspect()
+		return err
+	})
+}
+
+func BenchmarkInspectWithDetails(b *testing.B) {
+	benchInspect(b, func(ins *Inspector) error {
+		_, err := ins.InspectWithDetails()
+		return err
+	})
+}
+
+func BenchmarkInspectWithDetailsMarkdown(b *testing.B) {
+	benchInspect(b, func(ins *Inspector) error {
+		_, err := ins.InspectWithDetailsMarkdown()
+		return err
+	})
+}
+
+func BenchmarkInspectWithDetailsTOON(b *testing.B) {
+	benchInspect(b, func(ins *Inspector) error {
+		_, err := ins.InspectWithDetailsTOON()
+		return err
+	})
+}
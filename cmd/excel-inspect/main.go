@@ -0,0 +1,310 @@
+// Command excel-inspect inspects Excel workbooks and prints the result as
+// Markdown, TOON or JSON, or writes its formula dependency graph in
+// Graphviz DOT format.
+//
+// Usage:
+//
+//	excel-inspect [flags] file.xlsx|file.xls|file.ods|file.csv [...]
+//
+// Exit codes:
+//
+//	0  success
+//	1  inspection failed
+//	2  invalid arguments
+//	3  file not found
+//	4  file is not a readable workbook
+//	5  inspection timed out
+//	6  file is encrypted and the password is missing or wrong, or its
+//	   encryption is not supported
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	excelinspect "excel-inspect"
+)
+
+const (
+	exitOK = iota
+	exitFailure
+	exitUsage
+	exitNotFound
+	exitCorrupt
+	exitTimeout
+	exitPassword
+)
+
+var formats = []string{"markdown", "toon", "toon-sample", "json", "dot"}
+
+// patternList collects a repeatable string flag.
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+type options struct {
+	format    string
+	details   bool
+	sheets    patternList
+	hidden    bool
+	maxRows   int
+	samples   int
+	jobs      int
+	delim     string
+	delimiter rune
+	password  string
+	mergeFill string
+	timeout   int
+	output    string
+	compact   bool
+	quiet     bool
+	progress  bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	var opts options
+	fl := flag.NewFlagSet("excel-inspect", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	fl.StringVar(&opts.format, "format", "markdown", "output format: "+strings.Join(formats, ", "))
+	fl.BoolVar(&opts.details, "details", false, "include headers, columns and sections")
+	fl.Var(&opts.sheets, "sheet", "sheet name glob to inspect; prefix with ! to exclude (repeatable)")
+	fl.BoolVar(&opts.hidden, "include-hidden", false, "inspect hidden and very hidden sheets too")
+	fl.IntVar(&opts.maxRows, "max-rows", 0, "rows scanned per sheet for details (default 1000)")
+	fl.IntVar(&opts.samples, "samples", 0, "sample values kept per column (default 5)")
+	fl.IntVar(&opts.jobs, "concurrency", 0, "sheets inspected at once within a file (default 1)")
+	fl.StringVar(&opts.delim, "delimiter", "", "CSV/TSV field delimiter, one character or tab (default sniffed)")
+	fl.StringVar(&opts.password, "password", "", "password of encrypted workbooks")
+	fl.StringVar(&opts.mergeFill, "merge-fill", "none", "fill merged cells in section rows: none, down, across or all")
+	fl.IntVar(&opts.timeout, "timeout", 0, "abort each file after this many seconds (0 = no limit)")
+	fl.StringVar(&opts.output, "output", "", "write output to this file instead of stdout")
+	fl.BoolVar(&opts.compact, "compact", false, "compact JSON instead of indented")
+	fl.BoolVar(&opts.quiet, "quiet", false, "do not show a progress bar")
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: excel-inspect [flags] file.xlsx|file.xls|file.ods|file.csv [...]\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	files := fl.Args()
+	if len(files) == 0 {
+		fl.Usage()
+		return exitUsage
+	}
+	delimiter, ok := parseDelimiter(opts.delim)
+	if !ok {
+		fmt.Fprintf(stderr, "excel-inspect: invalid delimiter %q (want one character or tab)\n", opts.delim)
+		return exitUsage
+	}
+	opts.delimiter = delimiter
+	if _, ok := mergeFillModes[opts.mergeFill]; !ok {
+		fmt.Fprintf(stderr, "excel-inspect: invalid merge fill %q (want none, down, across or all)\n", opts.mergeFill)
+		return exitUsage
+	}
+	if !validFormat(opts.format) {
+		fmt.Fprintf(stderr, "excel-inspect: unknown format %q (want one of %s)\n", opts.format, strings.Join(formats, ", "))
+		return exitUsage
+	}
+	opts.progress = !opts.quiet && isTerminal(os.Stderr)
+
+	out := stdout
+	if opts.output != "" && opts.output != "-" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			fmt.Fprintf(stderr, "excel-inspect: %v\n", err)
+			return exitFailure
+		}
+		defer f.Close()
+		out = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	code := exitOK
+	for idx, path := range files {
+		if len(files) > 1 && opts.format != "json" {
+			if idx > 0 {
+				fmt.Fprintln(out)
+			}
+			fmt.Fprintf(out, "==> %s <==\n", path)
+		}
+		if err := inspectFile(ctx, path, opts, out, stderr); err != nil {
+			fmt.Fprintf(stderr, "excel-inspect: %s: %v\n", path, err)
+			if code == exitOK {
+				code = exitCode(err)
+			}
+		}
+	}
+	return code
+}
+
+// parseDelimiter reads the --delimiter flag; "" leaves it to sniffing.
+func parseDelimiter(v string) (rune, bool) {
+	switch v {
+	case "":
+		return 0, true
+	case "tab", `\t`:
+		return '\t', true
+	}
+	r := []rune(v)
+	if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' {
+		return 0, false
+	}
+	return r[0], true
+}
+
+// mergeFillModes maps the --merge-fill values to their modes.
+var mergeFillModes = map[string]excelinspect.MergeFill{
+	"none":   excelinspect.MergeFillNone,
+	"down":   excelinspect.MergeFillDown,
+	"across": excelinspect.MergeFillAcross,
+	"all":    excelinspect.MergeFillAll,
+}
+
+func validFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// openError marks errors from opening the workbook at path, as opposed to
+// inspecting it.
+type openError struct {
+	path string
+	err  error
+}
+
+func (e *openError) Error() string { return e.err.Error() }
+func (e *openError) Unwrap() error { return e.err }
+
+// notFound reports whether the workbook file itself could not be opened
+// because it does not exist. Parts missing inside a package are not a
+// missing file.
+func (e *openError) notFound() bool {
+	var pathErr *fs.PathError
+	return errors.As(e.err, &pathErr) && pathErr.Op == "open" && pathErr.Path == e.path &&
+		errors.Is(pathErr, fs.ErrNotExist)
+}
+
+func exitCode(err error) int {
+	var open *openError
+	isOpen := errors.As(err, &open)
+	switch {
+	case isOpen && open.notFound():
+		return exitNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, excelinspect.ErrPasswordRequired), errors.Is(err, excelinspect.ErrWrongPassword),
+		errors.Is(err, excelinspect.ErrUnsupportedEncryption):
+		return exitPassword
+	case isOpen:
+		return exitCorrupt
+	}
+	return exitFailure
+}
+
+func inspectFile(ctx context.Context, path string, opts options, out, stderr io.Writer) error {
+	inspectorOpts := []excelinspect.InspectorOption{
+		excelinspect.WithSheetFilter(opts.sheets...),
+		excelinspect.WithHiddenSheets(opts.hidden),
+		excelinspect.WithMaxSampleRows(opts.maxRows),
+		excelinspect.WithMaxSamples(opts.samples),
+		excelinspect.WithConcurrency(opts.jobs),
+		excelinspect.WithDelimiter(opts.delimiter),
+		excelinspect.WithPassword(opts.password),
+		excelinspect.WithMergedCellFill(mergeFillModes[opts.mergeFill]),
+	}
+	if opts.timeout > 0 {
+		// One deadline covers both inspecting and rendering the file.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(opts.timeout)*time.Second)
+		defer cancel()
+	}
+	var bar *progressBar
+	if opts.progress {
+		bar = &progressBar{w: stderr, label: path}
+		inspectorOpts = append(inspectorOpts, excelinspect.WithProgressCallback(bar.update))
+		defer bar.stop()
+	}
+
+	ins, err := excelinspect.New(path, inspectorOpts...)
+	if err != nil {
+		return &openError{path: path, err: err}
+	}
+	defer ins.Close()
+
+	details := opts.details || opts.format == "toon-sample" || opts.format == "dot"
+	var info *excelinspect.FileInfo
+	if details {
+		info, err = ins.InspectWithDetailsContext(ctx)
+	} else {
+		info, err = ins.InspectContext(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	// Rendering streams to out, so the bar is removed for good rather than
+	// redrawn between output lines.
+	bar.stop()
+
+	render := excelinspect.RenderOptions{Detailed: details, Sample: opts.format == "toon-sample"}
+	switch opts.format {
+	case "markdown":
+		err = ins.WriteMarkdownContext(ctx, out, info, render)
+	case "toon", "toon-sample":
+		if err = ins.WriteTOONContext(ctx, out, info, render); err == nil {
+			_, err = io.WriteString(out, "\n")
+		}
+	case "json":
+		err = writeJSON(path, info, opts.compact, out)
+	case "dot":
+		err = excelinspect.WriteDependencyDOT(out, info)
+	}
+	return err
+}
+
+// writeJSON writes one JSON document per file, tagged with the file path so
+// several files can be told apart in the output stream.
+func writeJSON(path string, info *excelinspect.FileInfo, compact bool, out io.Writer) error {
+	doc := struct {
+		File string `json:"file"`
+		*excelinspect.FileInfo
+	}{File: path, FileInfo: info}
+	enc := json.NewEncoder(out)
+	if !compact {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(doc)
+}
+
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	excelinspect "excel-inspect"
+)
+
+// testFiles writes a readable CSV workbook and a corrupt .xlsx file to a
+// temporary directory and returns their paths and the path of a file that
+// does not exist.
+func testFiles(t *testing.T) (ok, corrupt, missing string) {
+	t.Helper()
+	dir := t.TempDir()
+	ok = filepath.Join(dir, "ok.csv")
+	corrupt = filepath.Join(dir, "corrupt.xlsx")
+	missing = filepath.Join(dir, "missing.xlsx")
+	if err := os.WriteFile(ok, []byte("NAME,QTY\nBolt,10\nNut,20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(corrupt, []byte("this is not a zip archive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return ok, corrupt, missing
+}
+
+func TestExitCodes(t *testing.T) {
+	ok, corrupt, missing := testFiles(t)
+	// encrypted.xlsx is an Agile-encrypted package with the password
+	// "secret".
+	encrypted := filepath.Join("testdata", "encrypted.xlsx")
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"success", []string{ok}, exitOK},
+		{"password given", []string{"--password", "secret", encrypted}, exitOK},
+		{"bad flag", []string{"--no-such-flag", ok}, exitUsage},
+		{"bad format", []string{"--format", "xml", ok}, exitUsage},
+		{"bad delimiter", []string{"--delimiter", "ab", ok}, exitUsage},
+		{"no files", nil, exitUsage},
+		{"missing file", []string{missing}, exitNotFound},
+		{"corrupt file", []string{corrupt}, exitCorrupt},
+		{"missing password", []string{encrypted}, exitPassword},
+		{"wrong password", []string{"--password", "guess", encrypted}, exitPassword},
+		// Every file is inspected, but the exit code is the first failure's.
+		{"first failure wins", []string{ok, missing, corrupt, encrypted}, exitNotFound},
+		{"first failure wins, reordered", []string{corrupt, ok, encrypted, missing}, exitCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if got := run(append([]string{"--quiet"}, tt.args...), &stdout, &stderr); got != tt.want {
+				t.Errorf("exit code = %d, want %d; stderr:\n%s", got, tt.want, stderr.String())
+			}
+		})
+	}
+}
+
+func TestEveryFileIsInspected(t *testing.T) {
+	ok, corrupt, missing := testFiles(t)
+	var stdout, stderr bytes.Buffer
+	if got := run([]string{"--quiet", missing, corrupt, ok}, &stdout, &stderr); got != exitNotFound {
+		t.Errorf("exit code = %d, want %d", got, exitNotFound)
+	}
+	for _, path := range []string{missing, corrupt} {
+		if !strings.Contains(stderr.String(), path+":") {
+			t.Errorf("stderr does not report %s:\n%s", path, stderr.String())
+		}
+	}
+	if !strings.Contains(stdout.String(), "==> "+ok+" <==") || !strings.Contains(stdout.String(), "| ok |") {
+		t.Errorf("stdout does not hold the report of %s:\n%s", ok, stdout.String())
+	}
+}
+
+func TestTimeoutExitCode(t *testing.T) {
+	// --timeout counts whole seconds, too coarse to hit reliably on a small
+	// file, so the deadline is applied to the library call directly.
+	ok, _, _ := testFiles(t)
+	ins, err := excelinspect.New(ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = ins.InspectWithDetailsContext(ctx)
+	if err == nil {
+		t.Fatal("inspection past its deadline succeeded")
+	}
+	if got := exitCode(err); got != exitTimeout {
+		t.Errorf("exit code of %q = %d, want %d", err, got, exitTimeout)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	excelinspect "excel-inspect"
+)
+
+const progressBarWidth = 30
+
+// progressBar draws ProgressInfo events as a single, redrawn line. A nil
+// progressBar ignores every call.
+type progressBar struct {
+	w       io.Writer
+	label   string
+	drawn   int
+	stopped bool
+}
+
+func (b *progressBar) update(p excelinspect.ProgressInfo) {
+	if b == nil || b.stopped {
+		return
+	}
+	filled := int(p.Percent / 100 * progressBarWidth)
+	filled = max(0, min(progressBarWidth, filled))
+	line := fmt.Sprintf("%s [%s%s] %3.0f%% %s",
+		b.label,
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", progressBarWidth-filled),
+		p.Percent,
+		p.Phase,
+	)
+	if p.Sheet != "" {
+		line += " " + p.Sheet
+	}
+	b.draw(line)
+}
+
+// stop erases the bar and ignores later updates, so regular output starts
+// on a clean line.
+func (b *progressBar) stop() {
+	if b == nil || b.stopped {
+		return
+	}
+	b.stopped = true
+	if b.drawn == 0 {
+		return
+	}
+	b.draw("")
+	fmt.Fprint(b.w, "\r")
+}
+
+func (b *progressBar) draw(line string) {
+	pad := ""
+	if n := b.drawn - len(line); n > 0 {
+		pad = strings.Repeat(" ", n)
+	}
+	fmt.Fprint(b.w, "\r"+line+pad)
+	b.drawn = len(line)
+}
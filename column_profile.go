@@ -0,0 +1,418 @@
+package excelinspect
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultProfileTopValues is how many frequent values a profile lists.
+	defaultProfileTopValues = 5
+	// exactDistinctLimit is how many distinct values are counted exactly
+	// before the profile switches to a HyperLogLog estimate.
+	exactDistinctLimit = 10000
+	// hllPrecision gives 2^12 registers, a standard error of about 1.6%.
+	hllPrecision = 12
+)
+
+// ColumnProfile summarises the shape of a column's scanned values. It is only
+// computed when profiling is enabled with WithColumnProfiling.
+//
+// NullCount counts empty cells and BlankCount whitespace-only cells, both in
+// rows that hold data. DistinctCount is exact unless DistinctEstimated is set,
+// in which case it is a HyperLogLog estimate. Numeric is set for integer,
+// decimal, currency and percentage columns, over every value that parses as a
+// number; Dates is set for date, datetime and time columns, over the values
+// of the column's own type.
+type ColumnProfile struct {
+	NullCount         int           `json:"null_count"`
+	BlankCount        int           `json:"blank_count"`
+	DistinctCount     int           `json:"distinct_count"`
+	DistinctEstimated bool          `json:"distinct_estimated,omitempty"`
+	Numeric           *NumericStats `json:"numeric,omitempty"`
+	Dates             *DateStats    `json:"dates,omitempty"`
+	Length            LengthStats   `json:"length"`
+	TopValues         []ValueCount  `json:"top_values,omitempty"`
+}
+
+// NumericStats describes the numeric values of a column.
+type NumericStats struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	P25    float64 `json:"p25"`
+	P50    float64 `json:"p50"`
+	P75    float64 `json:"p75"`
+	P95    float64 `json:"p95"`
+}
+
+// DateStats describes the date and time values of a column. StdDevDays is the
+// standard deviation in days.
+type DateStats struct {
+	Min        time.Time `json:"min"`
+	Max        time.Time `json:"max"`
+	Mean       time.Time `json:"mean"`
+	StdDevDays float64   `json:"stddev_days"`
+	P25        time.Time `json:"p25"`
+	P50        time.Time `json:"p50"`
+	P75        time.Time `json:"p75"`
+	P95        time.Time `json:"p95"`
+}
+
+// LengthStats describes the length in characters of a column's non-empty
+// values.
+type LengthStats struct {
+	Min int     `json:"min"`
+	Max int     `json:"max"`
+	Avg float64 `json:"avg"`
+}
+
+// ValueCount is a value and how many times it occurs.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// WithColumnProfiling turns on per-column profiling: null and distinct counts,
+// numeric and date statistics, value lengths and the most frequent values.
+// It is off by default since it keeps every scanned value in memory.
+func WithColumnProfiling(enabled bool) InspectorOption {
+	return func(i *Inspector) {
+		i.config.profile = enabled
+	}
+}
+
+// WithProfileTopValues sets how many of the most frequent values a column
+// profile lists (default 5).
+func WithProfileTopValues(n int) InspectorOption {
+	return func(i *Inspector) {
+		if n > 0 {
+			i.config.profileTopValues = n
+		}
+	}
+}
+
+// columnProfiler accumulates one column's values while a section is built.
+// Profilers of merged sections are merged before the profile is finalized.
+type columnProfiler struct {
+	nulls    int
+	blanks   int
+	counts   map[string]int
+	sketch   *hyperLogLog
+	values   []typedValue
+	lengths  []int
+	totalLen int
+}
+
+// typedValue is a non-empty value with its inferred type.
+type typedValue struct {
+	text     string
+	dataType string
+}
+
+func newColumnProfiler() *columnProfiler {
+	return &columnProfiler{
+		counts: make(map[string]int),
+		sketch: newHyperLogLog(),
+	}
+}
+
+// add records one cell's trimmed value. blank is set for cells that held
+// only whitespace.
+func (p *columnProfiler) add(v string, blank bool, dataType string) {
+	if v == "" {
+		if blank {
+			p.blanks++
+		} else {
+			p.nulls++
+		}
+		return
+	}
+	p.sketch.add(v)
+	// Past the exact limit only values already seen keep their counts, which
+	// is enough for the top-N list.
+	if _, ok := p.counts[v]; ok || len(p.counts) < exactDistinctLimit {
+		p.counts[v]++
+	}
+	p.values = append(p.values, typedValue{text: v, dataType: dataType})
+	n := utf8.RuneCountInString(v)
+	p.lengths = append(p.lengths, n)
+	p.totalLen += n
+}
+
+// merge folds another profiler of the same column into p.
+func (p *columnProfiler) merge(o *columnProfiler) {
+	if o == nil {
+		return
+	}
+	p.nulls += o.nulls
+	p.blanks += o.blanks
+	for v, n := range o.counts {
+		if _, ok := p.counts[v]; ok || len(p.counts) < exactDistinctLimit {
+			p.counts[v] += n
+		}
+	}
+	p.sketch.merge(o.sketch)
+	p.values = append(p.values, o.values...)
+	p.lengths = append(p.lengths, o.lengths...)
+	p.totalLen += o.totalLen
+}
+
+// profile computes the column profile for a column whose dominant type is
+// dataType.
+func (p *columnProfiler) profile(dataType string, topN int) *ColumnProfile {
+	out := &ColumnProfile{
+		NullCount:     p.nulls,
+		BlankCount:    p.blanks,
+		DistinctCount: len(p.counts),
+	}
+	if len(p.counts) >= exactDistinctLimit {
+		out.DistinctCount = max(len(p.counts), int(math.Round(p.sketch.estimate())))
+		out.DistinctEstimated = true
+	}
+
+	if len(p.lengths) > 0 {
+		out.Length = LengthStats{
+			Min: slices.Min(p.lengths),
+			Max: slices.Max(p.lengths),
+			Avg: round3(float64(p.totalLen) / float64(len(p.lengths))),
+		}
+	}
+
+	switch dataType {
+	case DataTypeInteger, DataTypeDecimal, DataTypeCurrency, DataTypePercentage:
+		nums := make([]float64, 0, len(p.values))
+		for _, v := range p.values {
+			if n, ok := parseNumberValue(v.text, v.dataType); ok {
+				nums = append(nums, n)
+			}
+		}
+		if st := numericStats(nums); st != nil {
+			out.Numeric = &NumericStats{
+				Min:    st.Min,
+				Max:    st.Max,
+				Mean:   round3(st.Mean),
+				StdDev: round3(st.StdDev),
+				P25:    round3(st.P25),
+				P50:    round3(st.P50),
+				P75:    round3(st.P75),
+				P95:    round3(st.P95),
+			}
+		}
+	case DataTypeDate, DataTypeDateTime, DataTypeTime:
+		nums := make([]float64, 0, len(p.values))
+		for _, v := range p.values {
+			if v.dataType != dataType {
+				continue
+			}
+			if t, ok := parseTimeValue(v.text, v.dataType); ok {
+				nums = append(nums, t.Sub(excelEpoch).Hours()/24)
+			}
+		}
+		if s := numericStats(nums); s != nil {
+			out.Dates = &DateStats{
+				Min:        serialTime(s.Min),
+				Max:        serialTime(s.Max),
+				Mean:       serialTime(s.Mean),
+				StdDevDays: round3(s.StdDev),
+				P25:        serialTime(s.P25),
+				P50:        serialTime(s.P50),
+				P75:        serialTime(s.P75),
+				P95:        serialTime(s.P95),
+			}
+		}
+	}
+
+	out.TopValues = topValues(p.counts, topN)
+	return out
+}
+
+// numericStats returns unrounded summary statistics of nums, or nil when it
+// is empty.
+func numericStats(nums []float64) *NumericStats {
+	if len(nums) == 0 {
+		return nil
+	}
+	sort.Float64s(nums)
+	sum := 0.0
+	for _, n := range nums {
+		sum += n
+	}
+	mean := sum / float64(len(nums))
+	variance := 0.0
+	for _, n := range nums {
+		variance += (n - mean) * (n - mean)
+	}
+	variance /= float64(len(nums))
+	return &NumericStats{
+		Min:    nums[0],
+		Max:    nums[len(nums)-1],
+		Mean:   mean,
+		StdDev: math.Sqrt(variance),
+		P25:    percentile(nums, 0.25),
+		P50:    percentile(nums, 0.50),
+		P75:    percentile(nums, 0.75),
+		P95:    percentile(nums, 0.95),
+	}
+}
+
+// percentile interpolates linearly between the closest ranks of sorted.
+func percentile(sorted []float64, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// serialTime converts a day count from excelEpoch back to a time, rounded to
+// the second.
+func serialTime(days float64) time.Time {
+	return excelEpoch.Add(time.Duration(math.Round(days*86400)) * time.Second)
+}
+
+// topValues returns the n most frequent values, ties broken alphabetically.
+func topValues(counts map[string]int, n int) []ValueCount {
+	out := make([]ValueCount, 0, len(counts))
+	for v, c := range counts {
+		out = append(out, ValueCount{Value: v, Count: c})
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Count != out[b].Count {
+			return out[a].Count > out[b].Count
+		}
+		return out[a].Value < out[b].Value
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// finalizeProfiles turns the profilers of columns into ColumnProfile values.
+func finalizeProfiles(columns []ColumnInfo, topN int) {
+	for idx := range columns {
+		if columns[idx].profiler == nil {
+			continue
+		}
+		columns[idx].Profile = columns[idx].profiler.profile(columns[idx].DataType, topN)
+		columns[idx].profiler = nil
+	}
+}
+
+// formatTopValues renders top values as "a (3), b (2)" with the given
+// separator.
+func formatTopValues(values []ValueCount, sep string) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, v.Value+" ("+strconv.Itoa(v.Count)+")")
+	}
+	return strings.Join(parts, sep)
+}
+
+// hyperLogLog is a HyperLogLog distinct-count sketch.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+func (h *hyperLogLog) add(v string) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(v))
+	x := mix64(hasher.Sum64())
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) merge(o *hyperLogLog) {
+	for idx, r := range o.registers {
+		if r > h.registers[idx] {
+			h.registers[idx] = r
+		}
+	}
+}
+
+func (h *hyperLogLog) estimate() float64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities.
+		e = m * math.Log(m/float64(zeros))
+	}
+	return e
+}
+
+// mix64 is the splitmix64 finalizer, spreading FNV's weak low bits across
+// the whole word.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// profileStats is a profile's value statistics rendered as text for Markdown
+// and TOON: min, max, mean, stddev, p25, p50, p75 and p95. All are empty when
+// the column has no numeric or date values.
+func profileStats(p *ColumnProfile, dataType string) [8]string {
+	var out [8]string
+	switch {
+	case p.Numeric != nil:
+		n := p.Numeric
+		for idx, v := range []float64{n.Min, n.Max, n.Mean, n.StdDev, n.P25, n.P50, n.P75, n.P95} {
+			out[idx] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	case p.Dates != nil:
+		d := p.Dates
+		layout := "2006-01-02 15:04:05"
+		switch dataType {
+		case DataTypeDate:
+			layout = "2006-01-02"
+		case DataTypeTime:
+			layout = "15:04:05"
+		}
+		for idx, t := range []time.Time{d.Min, d.Max, d.Mean, {}, d.P25, d.P50, d.P75, d.P95} {
+			if idx == 3 {
+				out[idx] = strconv.FormatFloat(d.StdDevDays, 'f', -1, 64) + " days"
+				continue
+			}
+			out[idx] = t.Format(layout)
+		}
+	}
+	return out
+}
+
+// distinctLabel renders a distinct count, marking estimates with "~".
+func distinctLabel(p *ColumnProfile) string {
+	if p.DistinctEstimated {
+		return "~" + strconv.Itoa(p.DistinctCount)
+	}
+	return strconv.Itoa(p.DistinctCount)
+}
@@ -0,0 +1,127 @@
+package excelinspect
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{[]float64{7}, 0.25, 7},
+		{[]float64{7}, 0.95, 7},
+		{[]float64{10, 20}, 0.5, 15},
+		{[]float64{10, 20}, 0.95, 19.5},
+		{[]float64{1, 2, 3, 4}, 0, 1},
+		{[]float64{1, 2, 3, 4}, 0.25, 1.75},
+		{[]float64{1, 2, 3, 4}, 0.5, 2.5},
+		{[]float64{1, 2, 3, 4}, 0.75, 3.25},
+		{[]float64{1, 2, 3, 4}, 0.95, 3.85},
+		{[]float64{1, 2, 3, 4}, 1, 4},
+		{[]float64{1, 2, 3, 4, 5}, 0.5, 3},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestNumericProfile(t *testing.T) {
+	p := newColumnProfiler()
+	for _, v := range []string{"4", "1", "", "3", "2"} {
+		p.add(v, false, inferValueType(v, formatGeneral))
+	}
+	p.add("", true, DataTypeEmpty)
+	got := p.profile(DataTypeInteger, 5)
+	want := &NumericStats{Min: 1, Max: 4, Mean: 2.5, StdDev: 1.118, P25: 1.75, P50: 2.5, P75: 3.25, P95: 3.85}
+	if !reflect.DeepEqual(got.Numeric, want) {
+		t.Errorf("numeric = %+v, want %+v", got.Numeric, want)
+	}
+	if got.NullCount != 1 || got.BlankCount != 1 || got.DistinctCount != 4 || got.DistinctEstimated {
+		t.Errorf("nulls, blanks, distinct = %d, %d, %d (estimated %t), want 1, 1, 4 exact",
+			got.NullCount, got.BlankCount, got.DistinctCount, got.DistinctEstimated)
+	}
+}
+
+func TestDistinctCount(t *testing.T) {
+	tests := []struct {
+		distinct  int
+		estimated bool
+	}{
+		{exactDistinctLimit - 1, false},
+		{exactDistinctLimit, true},
+		{50000, true},
+		{200000, true},
+	}
+	for _, tt := range tests {
+		p := newColumnProfiler()
+		for n := 0; n < tt.distinct; n++ {
+			v := "v" + strconv.Itoa(n)
+			// Every value twice, so repeats do not count as distinct.
+			p.add(v, false, DataTypeString)
+			p.add(v, false, DataTypeString)
+		}
+		got := p.profile(DataTypeString, 5)
+		if got.DistinctEstimated != tt.estimated {
+			t.Errorf("%d values: estimated = %t, want %t", tt.distinct, got.DistinctEstimated, tt.estimated)
+		}
+		if !tt.estimated {
+			if got.DistinctCount != tt.distinct {
+				t.Errorf("%d values: distinct = %d, want exact", tt.distinct, got.DistinctCount)
+			}
+			continue
+		}
+		// 2^12 registers give a standard error of about 1.6%; allow three
+		// times that.
+		if errRate := math.Abs(float64(got.DistinctCount-tt.distinct)) / float64(tt.distinct); errRate > 0.05 {
+			t.Errorf("%d values: estimate %d is off by %.1f%%", tt.distinct, got.DistinctCount, errRate*100)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, b := newColumnProfiler(), newColumnProfiler()
+	for n := 0; n < 30000; n++ {
+		v := strconv.Itoa(n)
+		if n%2 == 0 {
+			a.add(v, false, DataTypeInteger)
+		} else {
+			b.add(v, false, DataTypeInteger)
+		}
+		// The halves overlap in 0-999.
+		if n < 1000 {
+			b.add(v, false, DataTypeInteger)
+		}
+	}
+	a.merge(b)
+	got := a.profile(DataTypeInteger, 5)
+	if !got.DistinctEstimated || math.Abs(float64(got.DistinctCount-30000))/30000 > 0.05 {
+		t.Errorf("merged distinct = %d (estimated %t), want about 30000", got.DistinctCount, got.DistinctEstimated)
+	}
+}
+
+func TestTopValues(t *testing.T) {
+	counts := map[string]int{"b": 3, "a": 3, "c": 5, "d": 1, "e": 3}
+	tests := []struct {
+		n    int
+		want []ValueCount
+	}{
+		{1, []ValueCount{{"c", 5}}},
+		{3, []ValueCount{{"c", 5}, {"a", 3}, {"b", 3}}},
+		{10, []ValueCount{{"c", 5}, {"a", 3}, {"b", 3}, {"e", 3}, {"d", 1}}},
+	}
+	for _, tt := range tests {
+		if got := topValues(counts, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("topValues(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+	if got, want := formatTopValues(topValues(counts, 2), ", "), "c (5), a (3)"; got != want {
+		t.Errorf("formatTopValues = %q, want %q", got, want)
+	}
+}
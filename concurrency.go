@@ -0,0 +1,86 @@
+package excelinspect
+
+import (
+	"context"
+	"sync"
+)
+
+// WithConcurrency lets Inspect and InspectWithDetails work on up to n sheets
+// at a time (default 1, one sheet after another). Results keep the
+// workbook's sheet order either way. Progress callbacks are never called
+// concurrently: events of one sheet stay in order, and the per-phase sheet
+// count only goes up.
+func WithConcurrency(n int) InspectorOption {
+	return func(i *Inspector) {
+		if n > 0 {
+			i.config.concurrency = n
+		}
+	}
+}
+
+// forEachSheet calls fn for every sheet, up to the configured number of
+// calls at once, and reports phase progress as sheets finish. The first
+// error cancels the sheets still running and is returned.
+func (i *Inspector) forEachSheet(ctx context.Context, phase string, sheets []string, fn func(ctx context.Context, idx int, sheetName string) error) error {
+	total := len(sheets)
+	i.emitProgress(phase, "", 0, total)
+	workers := min(i.config.concurrency, total)
+	if workers <= 1 {
+		for idx, sheetName := range sheets {
+			if err := fn(ctx, idx, sheetName); err != nil {
+				return err
+			}
+			i.emitProgress(phase, sheetName, idx+1, total)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		firstErr error
+		done     int
+		wg       sync.WaitGroup
+	)
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Go(func() {
+			for idx := range jobs {
+				err := fn(ctx, idx, sheets[idx])
+				mu.Lock()
+				switch {
+				case err != nil && firstErr == nil:
+					firstErr = err
+					cancel()
+				case err == nil && firstErr == nil:
+					// Counted under the lock so events arrive in order.
+					done++
+					i.emitProgress(phase, sheets[idx], done, total)
+				}
+				mu.Unlock()
+			}
+		})
+	}
+
+	next := 0
+feed:
+	for ; next < total; next++ {
+		select {
+		case jobs <- next:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if next < total {
+		// ctx ended between sheets, before any running sheet noticed.
+		return i.scanError(ctx, sheets[next], 0)
+	}
+	return nil
+}
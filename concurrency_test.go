@@ -0,0 +1,82 @@
+package excelinspect
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestConcurrentSheets is meant to be run with -race as well: the callback
+// keeps its state without locking, relying on callbacks never overlapping.
+func TestConcurrentSheets(t *testing.T) {
+	// Earlier sheets are longer, so later ones tend to finish first.
+	names := []string{"Zulu", "Alpha", "Mike", "Bravo", "Yankee", "Charlie"}
+	sheets := make([]testSheet, len(names))
+	for idx, name := range names {
+		rows := xrow(1, 0, "ID", "NAME", "QTY")
+		for n := 2; n <= 900-100*idx; n++ {
+			rows += xrow(n, 0, fmt.Sprint(n), fmt.Sprintf("item%d", n), fmt.Sprint(n*3))
+		}
+		sheets[idx] = testSheet{name: name, rows: rows}
+	}
+
+	var (
+		inFlight   atomic.Int32
+		overlapped atomic.Bool
+		lastRow    = map[string]int{}
+		lastDone   = map[string]int{}
+		problems   []string
+	)
+	callback := func(p ProgressInfo) {
+		if inFlight.Add(1) > 1 {
+			overlapped.Store(true)
+		}
+		defer inFlight.Add(-1)
+		// Widen the window for another callback to overlap this one.
+		time.Sleep(50 * time.Microsecond)
+
+		switch {
+		case p.Phase == "scan_sheet_rows":
+			if p.Current <= lastRow[p.Sheet] {
+				problems = append(problems, fmt.Sprintf("%s: row %d after %d", p.Sheet, p.Current, lastRow[p.Sheet]))
+			}
+			lastRow[p.Sheet] = p.Current
+		case p.Sheet != "":
+			if p.Current <= lastDone[p.Phase] {
+				problems = append(problems, fmt.Sprintf("%s: %d sheets done after %d", p.Phase, p.Current, lastDone[p.Phase]))
+			}
+			lastDone[p.Phase] = p.Current
+		}
+	}
+	ins := openTestWorkbook(t, xlsxFile(t, sheets, "", nil), WithConcurrency(4), WithProgressCallback(callback))
+	info, err := ins.InspectWithDetails()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, s := range info.Sheets {
+		got = append(got, s.Name)
+	}
+	if !reflect.DeepEqual(got, names) {
+		t.Errorf("sheets = %q, want workbook order %q", got, names)
+	}
+	for idx, s := range info.Sheets {
+		if want := 900 - 100*idx; s.RowCount != want {
+			t.Errorf("%s: %d rows, want %d", s.Name, s.RowCount, want)
+		}
+	}
+	if overlapped.Load() {
+		t.Error("progress callbacks ran concurrently")
+	}
+	for _, p := range problems {
+		t.Error(p)
+	}
+	for _, name := range names {
+		if lastRow[name] == 0 {
+			t.Errorf("%s: no scan_sheet_rows progress", name)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package excelinspect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// WithDelimiter sets the field delimiter of CSV/TSV input, such as ',', ';'
+// or '\t'. By default it is sniffed from the start of the file. Workbooks
+// ignore it.
+func WithDelimiter(delimiter rune) InspectorOption {
+	return func(i *Inspector) {
+		if delimiter != 0 && delimiter != '"' && delimiter != '\r' && delimiter != '\n' {
+			i.config.delimiter = delimiter
+		}
+	}
+}
+
+// textEncoding is the character encoding of delimited text input.
+type textEncoding int
+
+const (
+	encodingUTF8 textEncoding = iota
+	encodingUTF16LE
+	encodingUTF16BE
+	// encodingWindows1252 is assumed for text that is not valid UTF-8, as
+	// written by Excel's "CSV" export on Western Windows systems.
+	encodingWindows1252
+)
+
+// textSniffSize is how much of a text file is read to tell its encoding
+// and delimiter.
+const textSniffSize = 64 << 10
+
+// delimiterCandidates are the delimiters sniffing chooses from, preferred in
+// this order when equally likely.
+var delimiterCandidates = []rune{',', '\t', ';', '|'}
+
+// textSource is CSV or TSV input, presented as a workbook with one sheet.
+// Each sheet read decodes the text again from start, past any byte order
+// mark.
+type textSource struct {
+	r         io.ReaderAt
+	start     int64
+	size      int64
+	encoding  textEncoding
+	delimiter rune
+}
+
+// readText sniffs the encoding and, unless delimiter is set, the delimiter
+// of the text in r and returns it as a workbook whose only sheet is named
+// sheetName.
+func readText(r io.ReaderAt, size int64, sheetName string, delimiter rune) (*workbook, error) {
+	head := make([]byte, min(size, textSniffSize))
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	if len(head) == 0 {
+		return nil, errors.New("empty file")
+	}
+
+	src := &textSource{r: r, size: size}
+	src.encoding, src.start = sniffEncoding(head)
+	var sample strings.Builder
+	dec := newTextDecoder(bytes.NewReader(head[src.start:]), src.encoding)
+	for {
+		c, err := dec.readRune()
+		if err != nil {
+			break
+		}
+		sample.WriteRune(c)
+	}
+	if !isText(sample.String()) {
+		return nil, errors.New("not a workbook or delimited text file")
+	}
+	src.delimiter = delimiter
+	if src.delimiter == 0 {
+		src.delimiter = sniffDelimiter(sample.String(), int64(n) < size)
+	}
+	return &workbook{
+		sheets: []workbookSheet{{name: sheetName, offset: -1}},
+		epoch:  excelEpoch,
+		text:   src,
+	}, nil
+}
+
+// textSheetName names the sheet of a text file after the file, as Excel
+// does when opening one.
+func textSheetName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if path == "" || name == "" || name == "." {
+		return "Sheet1"
+	}
+	return name
+}
+
+// sniffEncoding returns the encoding of text starting with head and the
+// length of its byte order mark. Without a mark, UTF-16 is recognised by
+// the zero bytes of ASCII characters.
+func sniffEncoding(head []byte) (textEncoding, int64) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return encodingUTF8, 3
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return encodingUTF16LE, 2
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return encodingUTF16BE, 2
+	}
+	probe := head[:min(len(head), 1024)&^1]
+	var even, odd int
+	for idx := 0; idx < len(probe); idx += 2 {
+		if probe[idx] == 0 {
+			even++
+		}
+		if probe[idx+1] == 0 {
+			odd++
+		}
+	}
+	pairs := len(probe) / 2
+	switch {
+	case pairs > 0 && odd > pairs/2 && even == 0:
+		return encodingUTF16LE, 0
+	case pairs > 0 && even > pairs/2 && odd == 0:
+		return encodingUTF16BE, 0
+	}
+	// head may end inside a multi-byte character.
+	for cut := 0; cut < utf8.UTFMax && cut < len(head); cut++ {
+		if utf8.Valid(head[:len(head)-cut]) {
+			return encodingUTF8, 0
+		}
+	}
+	return encodingWindows1252, 0
+}
+
+// isText reports whether sample reads as text rather than binary data: no
+// NUL characters and few other control characters.
+func isText(sample string) bool {
+	var runes, controls int
+	for _, c := range sample {
+		runes++
+		switch {
+		case c == 0:
+			return false
+		case c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f':
+			controls++
+		}
+	}
+	return controls*100 <= runes
+}
+
+// sniffDelimiter picks the candidate that splits the most lines of sample
+// into the same number of fields. Delimiters inside quoted fields are not
+// counted. truncated tells that sample is cut short, so its last line is
+// left out.
+func sniffDelimiter(sample string, truncated bool) rune {
+	var lines []map[rune]int
+	counts := make(map[rune]int)
+	quoted := false
+	for _, c := range sample {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\n':
+			lines = append(lines, counts)
+			counts = make(map[rune]int)
+		default:
+			counts[c]++
+		}
+		if len(lines) == 100 {
+			break
+		}
+	}
+	if !truncated && len(counts) > 0 {
+		lines = append(lines, counts)
+	}
+
+	best, bestLines, bestFields := delimiterCandidates[0], 0, 0
+	for _, delim := range delimiterCandidates {
+		freq := make(map[int]int)
+		for _, line := range lines {
+			if n := line[delim]; n > 0 {
+				freq[n]++
+			}
+		}
+		for fields, n := range freq {
+			if n > bestLines || (n == bestLines && fields > bestFields) {
+				best, bestLines, bestFields = delim, n, fields
+			}
+		}
+	}
+	return best
+}
+
+// windows1252 maps bytes 0x80 to 0x9F of Windows-1252; the other bytes
+// are the same as in Latin-1. Undefined bytes map to themselves.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// textDecoder reads the runes of text in one of the supported encodings.
+// One rune can be put back with unread.
+type textDecoder struct {
+	br       *bufio.Reader
+	encoding textEncoding
+	back     rune
+	hasBack  bool
+}
+
+func newTextDecoder(r io.Reader, encoding textEncoding) *textDecoder {
+	return &textDecoder{br: bufio.NewReaderSize(r, 64<<10), encoding: encoding}
+}
+
+func (d *textDecoder) readRune() (rune, error) {
+	if d.hasBack {
+		d.hasBack = false
+		return d.back, nil
+	}
+	switch d.encoding {
+	case encodingUTF16LE, encodingUTF16BE:
+		u, err := d.unit()
+		if err != nil {
+			return 0, err
+		}
+		if utf16.IsSurrogate(u) {
+			low, err := d.unit()
+			if err != nil {
+				return utf8.RuneError, nil
+			}
+			return utf16.DecodeRune(u, low), nil
+		}
+		return u, nil
+	case encodingWindows1252:
+		b, err := d.br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b >= 0x80 && b < 0xA0 {
+			return windows1252[b-0x80], nil
+		}
+		return rune(b), nil
+	}
+	c, _, err := d.br.ReadRune()
+	return c, err
+}
+
+func (d *textDecoder) unread(c rune) {
+	d.back, d.hasBack = c, true
+}
+
+// unit reads one UTF-16 code unit.
+func (d *textDecoder) unit() (rune, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(d.br, b[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	if d.encoding == encodingUTF16BE {
+		return rune(b[0])<<8 | rune(b[1]), nil
+	}
+	return rune(b[1])<<8 | rune(b[0]), nil
+}
+
+// textSheetReader reads the records of delimited text as rows. Quoted
+// fields may hold delimiters, doubled quotes and line breaks; a quote in an
+// unquoted field is kept as is. Every record is a row, so empty lines leave
+// gaps in the row numbers as empty rows do in a worksheet.
+type textSheetReader struct {
+	dec       *textDecoder
+	delimiter rune
+	record    int
+	last      int
+	eof       bool
+	field     strings.Builder
+}
+
+func (src *textSource) openSheet() *textSheetReader {
+	return &textSheetReader{
+		dec:       newTextDecoder(io.NewSectionReader(src.r, src.start, src.size-src.start), src.encoding),
+		delimiter: src.delimiter,
+	}
+}
+
+// next returns the next record that has a non-empty field. Fields are
+// trimmed and placed like worksheet cells: empty fields are left out and
+// whitespace-only ones are marked blank.
+func (r *textSheetReader) next() (sheetRow, bool, error) {
+	for !r.eof {
+		row := sheetRow{Number: r.record + 1}
+		err := r.readRecord(func(col int, value string) {
+			if value != "" {
+				row.setCell(col, value, true, formatGeneral, false)
+			}
+		})
+		if err != nil {
+			return sheetRow{}, false, err
+		}
+		if row.Values != nil {
+			r.last = row.Number
+			return row, true, nil
+		}
+	}
+	return sheetRow{}, false, nil
+}
+
+// readRecord reads one record, calling fn with each field.
+func (r *textSheetReader) readRecord(fn func(col int, value string)) error {
+	col := 0
+	started := false
+	for {
+		r.field.Reset()
+		end, err := r.readField()
+		if err != nil {
+			return err
+		}
+		if r.eof && !started && end != r.delimiter && r.field.Len() == 0 {
+			// Nothing after the last line break.
+			return nil
+		}
+		started = true
+		fn(col, r.field.String())
+		col++
+		if end != r.delimiter {
+			r.record++
+			return nil
+		}
+	}
+}
+
+// readField reads one field into r.field and returns the rune that ended
+// it: the delimiter, '\n' for a line break or 0 at the end of the text.
+func (r *textSheetReader) readField() (rune, error) {
+	quoted := false
+	first := true
+	for {
+		c, err := r.dec.readRune()
+		if err == io.EOF {
+			r.eof = true
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case quoted:
+			if c != '"' {
+				r.field.WriteRune(c)
+				continue
+			}
+			next, err := r.dec.readRune()
+			if err == nil && next == '"' {
+				r.field.WriteByte('"')
+				continue
+			}
+			quoted = false
+			if err == io.EOF {
+				r.eof = true
+				return 0, nil
+			}
+			if err != nil {
+				return 0, err
+			}
+			c = next
+		case first && c == '"':
+			quoted = true
+			first = false
+			continue
+		}
+		first = false
+		switch c {
+		case r.delimiter:
+			return c, nil
+		case '\n':
+			return '\n', nil
+		case '\r':
+			if next, err := r.dec.readRune(); err == nil && next != '\n' {
+				r.dec.unread(next)
+			}
+			return '\n', nil
+		}
+		r.field.WriteRune(c)
+	}
+}
+
+// finish reads the remaining records, counting them. It stops with ctx's
+// error once ctx is done.
+func (r *textSheetReader) finish(ctx context.Context) error {
+	for n := 0; ; n++ {
+		if n%1024 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		_, ok, err := r.next()
+		if err != nil || !ok {
+			return err
+		}
+	}
+}
+
+// dimensionRows is never known for text: rows have to be counted.
+func (r *textSheetReader) dimensionRows() (int, bool) { return 0, false }
+
+func (r *textSheetReader) lastRow() int { return r.last }
+
+func (r *textSheetReader) mergeRanges() []mergeRange { return nil }
+
+// hiddenLines is always empty: text has no hidden rows or columns.
+func (r *textSheetReader) hiddenLines() (rows, cols []lineSpan) { return nil, nil }
+
+func (r *textSheetReader) close() {}
@@ -0,0 +1,90 @@
+package excelinspect
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"unicode/utf16"
+)
+
+func utf16LE(s string) []byte {
+	out := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u), byte(u>>8))
+	}
+	return out
+}
+
+func TestReadText(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want [][]string
+	}{
+		{
+			name: "BOM, semicolons and a quoted multiline field",
+			data: []byte("\xEF\xBB\xBFname;note\r\nA;\"line 1\nline 2; still\"\r\nB;x\r\n"),
+			want: [][]string{{"name", "note"}, {"A", "line 1\nline 2; still"}, {"B", "x"}},
+		},
+		{
+			name: "tabs and doubled quotes",
+			data: []byte("name\tnote\nA\t\"say \"\"hi\"\"\"\n"),
+			want: [][]string{{"name", "note"}, {"A", `say "hi"`}},
+		},
+		{
+			name: "UTF-16 with BOM",
+			data: utf16LE("name,city\nA,Köln\n"),
+			want: [][]string{{"name", "city"}, {"A", "Köln"}},
+		},
+		{
+			name: "Windows-1252",
+			data: []byte("name|price\nA|\x8010\n"),
+			want: [][]string{{"name", "price"}, {"A", "€10"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ins, err := NewFromBytes(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ins.Close()
+			if names := ins.wb.sheetNames(); !reflect.DeepEqual(names, []string{"Sheet1"}) {
+				t.Fatalf("sheets = %q, want [Sheet1]", names)
+			}
+			d, err := ins.sheetData(context.Background(), "Sheet1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(d.rows, tt.want) {
+				t.Errorf("rows = %q, want %q", d.rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextUnderWorkbookName(t *testing.T) {
+	html := []byte("<html><table><tr><td>a</td></tr></table></html>\n")
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"export.csv", false},
+		{"export.txt", false},
+		{"export.xls", true},
+		{"export.xlsx", true},
+		{"export.ods", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ins, err := NewFromFS(fstest.MapFS{tt.name: {Data: html}}, tt.name)
+			if err == nil {
+				ins.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package excelinspect
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+)
+
+// ErrPasswordRequired is returned when opening a password-encrypted workbook
+// without WithPassword.
+var ErrPasswordRequired = errors.New("excelinspect: workbook is encrypted, a password is required")
+
+// ErrWrongPassword is returned when the WithPassword password does not
+// decrypt the workbook.
+var ErrWrongPassword = errors.New("excelinspect: wrong password")
+
+// ErrUnsupportedEncryption is returned when opening an encrypted workbook
+// whose encryption cannot be decrypted, such as an encrypted .xls workbook
+// or a package encrypted with a certificate instead of a password.
+var ErrUnsupportedEncryption = errors.New("excelinspect: unsupported workbook encryption")
+
+// defaultPassword is what Excel encrypts with when a workbook is protected
+// without a password of the user's (such as "read-only recommended"); it
+// opens such files without asking.
+const defaultPassword = "VelvetSweatshop"
+
+// WithPassword sets the password of an encrypted workbook. The package is
+// decrypted in memory once, when the Inspector is opened. Both Agile (Office
+// 2010 and later) and Standard (Office 2007) ECMA-376 encryption are
+// supported.
+func WithPassword(password string) InspectorOption {
+	return func(i *Inspector) {
+		i.config.password = password
+	}
+}
+
+// readCompoundFile reads a compound file: an .xls workbook, or a package
+// encrypted with a password, which is decrypted and read as a zip archive.
+func (i *Inspector) readCompoundFile(r io.ReaderAt) (*workbook, error) {
+	doc, err := mscfb.New(r)
+	if err != nil {
+		return nil, err
+	}
+	streams := make(map[string]*mscfb.File)
+	for _, f := range doc.File {
+		if len(f.Path) == 0 {
+			streams[f.Name] = f
+		}
+	}
+	info, pkg := streams["EncryptionInfo"], streams["EncryptedPackage"]
+	if info == nil || pkg == nil {
+		return readXLS(streams)
+	}
+
+	infoData, err := io.ReadAll(info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EncryptionInfo: %w", err)
+	}
+	pkgData, err := io.ReadAll(pkg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EncryptedPackage: %w", err)
+	}
+	password := i.config.password
+	if password == "" {
+		password = defaultPassword
+	}
+	data, err := decryptPackage(infoData, pkgData, password)
+	if errors.Is(err, ErrWrongPassword) && i.config.password == "" {
+		return nil, ErrPasswordRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readZipWorkbook(bytes.NewReader(data), int64(len(data)))
+}
+
+// decryptPackage decrypts an EncryptedPackage stream with the key that
+// password yields under the EncryptionInfo stream info.
+func decryptPackage(info, pkg []byte, password string) ([]byte, error) {
+	if len(info) < 8 || len(pkg) < 8 {
+		return nil, errors.New("truncated encryption streams")
+	}
+	major, minor := binary.LittleEndian.Uint16(info), binary.LittleEndian.Uint16(info[2:])
+	size := binary.LittleEndian.Uint64(pkg)
+	var (
+		data []byte
+		err  error
+	)
+	switch {
+	case major == 4 && minor == 4:
+		data, err = decryptAgile(info[8:], pkg[8:], password)
+	case (major == 2 || major == 3 || major == 4) && minor == 2:
+		data, err = decryptStandard(info[8:], pkg[8:], password)
+	default:
+		return nil, fmt.Errorf("%w: version %d.%d", ErrUnsupportedEncryption, major, minor)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(len(data)) {
+		return nil, errors.New("truncated EncryptedPackage stream")
+	}
+	return data[:size], nil
+}
+
+// passwordBytes is the UTF-16LE encoding of password that the key
+// derivations hash.
+func passwordBytes(password string) []byte {
+	units := utf16.Encode([]rune(password))
+	out := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		out = binary.LittleEndian.AppendUint16(out, u)
+	}
+	return out
+}
+
+// hashPassword hashes salt and password, then rehashes spinCount times with
+// the iteration number in front, the first steps of both key derivations.
+func hashPassword(newHash func() hash.Hash, salt []byte, password string, spinCount int) []byte {
+	h := newHash()
+	h.Write(salt)
+	h.Write(passwordBytes(password))
+	sum := h.Sum(nil)
+	var iter [4]byte
+	for n := 0; n < spinCount; n++ {
+		binary.LittleEndian.PutUint32(iter[:], uint32(n))
+		h.Reset()
+		h.Write(iter[:])
+		h.Write(sum)
+		sum = h.Sum(sum[:0])
+	}
+	return sum
+}
+
+// decryptStandard decrypts a package with Standard encryption: AES in ECB
+// mode under a SHA-1 derived key.
+func decryptStandard(info, pkg []byte, password string) ([]byte, error) {
+	if len(info) < 4 {
+		return nil, errors.New("truncated EncryptionInfo stream")
+	}
+	headerSize := int(binary.LittleEndian.Uint32(info))
+	header := info[4:]
+	if headerSize < 32 || len(header) < headerSize {
+		return nil, errors.New("truncated EncryptionInfo stream")
+	}
+	algID := binary.LittleEndian.Uint32(header[8:])
+	keyBits := int(binary.LittleEndian.Uint32(header[16:]))
+	if algID != 0x660E && algID != 0x660F && algID != 0x6610 {
+		return nil, fmt.Errorf("%w: algorithm %#x", ErrUnsupportedEncryption, algID)
+	}
+	verifier := header[headerSize:]
+	if len(verifier) < 4+16+16+4+32 {
+		return nil, errors.New("truncated EncryptionInfo stream")
+	}
+	salt := verifier[4:20]
+	encVerifier := verifier[20:36]
+	encVerifierHash := verifier[40:72]
+
+	block, err := aes.NewCipher(standardKey(salt, password, keyBits))
+	if err != nil {
+		return nil, err
+	}
+	plainVerifier := decryptECB(block, encVerifier)
+	plainHash := decryptECB(block, encVerifierHash)
+	if want := sha1.Sum(plainVerifier); !bytes.Equal(plainHash[:sha1.Size], want[:]) {
+		return nil, ErrWrongPassword
+	}
+	return decryptECB(block, pkg[:len(pkg)&^(aes.BlockSize-1)]), nil
+}
+
+// standardKey derives the AES key of Standard encryption (2.3.4.7): the
+// password is hashed, then the key is derived from the hash of the first
+// block through the 0x36/0x5C expansion.
+func standardKey(salt []byte, password string, keyBits int) []byte {
+	sum := hashPassword(sha1.New, salt, password, 50000)
+	final := sha1.Sum(append(sum, 0, 0, 0, 0))
+	expand := func(fill byte) []byte {
+		buf := bytes.Repeat([]byte{fill}, 64)
+		for idx, b := range final {
+			buf[idx] ^= b
+		}
+		s := sha1.Sum(buf)
+		return s[:]
+	}
+	return append(expand(0x36), expand(0x5C)...)[:keyBits/8]
+}
+
+func decryptECB(block cipher.Block, data []byte) []byte {
+	out := make([]byte, len(data))
+	for off := 0; off+block.BlockSize() <= len(data); off += block.BlockSize() {
+		block.Decrypt(out[off:], data[off:])
+	}
+	return out
+}
+
+// agileParams are the attributes shared by <keyData> and
+// <p:encryptedKey> in an Agile EncryptionInfo descriptor.
+type agileParams struct {
+	SaltValue       string `xml:"saltValue,attr"`
+	BlockSize       int    `xml:"blockSize,attr"`
+	KeyBits         int    `xml:"keyBits,attr"`
+	HashSize        int    `xml:"hashSize,attr"`
+	CipherAlgorithm string `xml:"cipherAlgorithm,attr"`
+	CipherChaining  string `xml:"cipherChaining,attr"`
+	HashAlgorithm   string `xml:"hashAlgorithm,attr"`
+}
+
+// agileKey is the <p:encryptedKey> of the password key encryptor: the
+// password's key derivation and the values it decrypts.
+type agileKey struct {
+	agileParams
+	SpinCount                  int    `xml:"spinCount,attr"`
+	EncryptedVerifierHashInput string `xml:"encryptedVerifierHashInput,attr"`
+	EncryptedVerifierHashValue string `xml:"encryptedVerifierHashValue,attr"`
+	EncryptedKeyValue          string `xml:"encryptedKeyValue,attr"`
+}
+
+// Block keys of the Agile key derivation (MS-OFFCRYPTO 2.3.4.13).
+var (
+	agileVerifierInputKey = []byte{0xfe, 0xa7, 0xd2, 0x76, 0x3b, 0x4b, 0x9e, 0x79}
+	agileVerifierValueKey = []byte{0xd7, 0xaa, 0x0f, 0x6d, 0x30, 0x61, 0x34, 0x4e}
+	agileSecretKey        = []byte{0x14, 0x6e, 0x0b, 0xe7, 0xab, 0xac, 0xd0, 0xd6}
+)
+
+// decryptAgile decrypts a package with Agile encryption: the password
+// decrypts the package's secret key, which decrypts the package in 4096-byte
+// segments, each with its own IV.
+func decryptAgile(info, pkg []byte, password string) ([]byte, error) {
+	var desc struct {
+		KeyData       agileParams `xml:"keyData"`
+		KeyEncryptors []struct {
+			URI string   `xml:"uri,attr"`
+			Key agileKey `xml:"encryptedKey"`
+		} `xml:"keyEncryptors>keyEncryptor"`
+	}
+	if err := xml.Unmarshal(info, &desc); err != nil {
+		return nil, fmt.Errorf("failed to read EncryptionInfo: %w", err)
+	}
+	var key *agileKey
+	for idx, enc := range desc.KeyEncryptors {
+		if enc.URI == "http://schemas.microsoft.com/office/2006/keyEncryptor/password" {
+			key = &desc.KeyEncryptors[idx].Key
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: not encrypted with a password", ErrUnsupportedEncryption)
+	}
+	for _, p := range []agileParams{desc.KeyData, key.agileParams} {
+		if p.CipherAlgorithm != "AES" || p.CipherChaining != "ChainingModeCBC" {
+			return nil, fmt.Errorf("%w: cipher %s/%s", ErrUnsupportedEncryption, p.CipherAlgorithm, p.CipherChaining)
+		}
+	}
+	// MS-OFFCRYPTO caps the spin count at 10,000,000; a larger one would
+	// hash the password for as long as the file asks.
+	if key.SpinCount < 0 || key.SpinCount > 10_000_000 {
+		return nil, fmt.Errorf("%w: spin count %d", ErrUnsupportedEncryption, key.SpinCount)
+	}
+	keyHash, err := agileHash(key.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	dataHash, err := agileHash(desc.KeyData.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	keySalt, err := base64.StdEncoding.DecodeString(key.SaltValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EncryptionInfo: %w", err)
+	}
+	dataSalt, err := base64.StdEncoding.DecodeString(desc.KeyData.SaltValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EncryptionInfo: %w", err)
+	}
+
+	sum := hashPassword(keyHash, keySalt, password, key.SpinCount)
+	decryptKeyField := func(blockKey []byte, field string) ([]byte, error) {
+		h := keyHash()
+		h.Write(sum)
+		h.Write(blockKey)
+		derived := fitLength(h.Sum(nil), key.KeyBits/8, 0x36)
+		data, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read EncryptionInfo: %w", err)
+		}
+		return decryptCBC(derived, fitLength(keySalt, key.BlockSize, 0x36), data)
+	}
+	input, err := decryptKeyField(agileVerifierInputKey, key.EncryptedVerifierHashInput)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decryptKeyField(agileVerifierValueKey, key.EncryptedVerifierHashValue)
+	if err != nil {
+		return nil, err
+	}
+	h := keyHash()
+	h.Write(input[:min(len(input), len(keySalt))])
+	if want := h.Sum(nil); len(value) < len(want) || !bytes.Equal(value[:len(want)], want) {
+		return nil, ErrWrongPassword
+	}
+	secret, err := decryptKeyField(agileSecretKey, key.EncryptedKeyValue)
+	if err != nil {
+		return nil, err
+	}
+	secret = fitLength(secret, desc.KeyData.KeyBits/8, 0x36)
+
+	const segmentSize = 4096
+	out := make([]byte, 0, len(pkg))
+	var segment [4]byte
+	for idx, off := 0, 0; off < len(pkg); idx, off = idx+1, off+segmentSize {
+		binary.LittleEndian.PutUint32(segment[:], uint32(idx))
+		h := dataHash()
+		h.Write(dataSalt)
+		h.Write(segment[:])
+		iv := fitLength(h.Sum(nil), desc.KeyData.BlockSize, 0x36)
+		plain, err := decryptCBC(secret, iv, pkg[off:min(off+segmentSize, len(pkg))])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, plain...)
+	}
+	return out, nil
+}
+
+func agileHash(name string) (func() hash.Hash, error) {
+	switch name {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA384":
+		return sha512.New384, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("%w: hash algorithm %q", ErrUnsupportedEncryption, name)
+}
+
+// fitLength truncates b to n bytes or pads it with fill.
+func fitLength(b []byte, n int, fill byte) []byte {
+	if len(b) >= n {
+		return b[:n]
+	}
+	return append(append([]byte(nil), b...), bytes.Repeat([]byte{fill}, n-len(b))...)
+}
+
+func decryptCBC(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("invalid encryption block size")
+	}
+	data = data[:len(data)&^(block.BlockSize()-1)]
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	return out, nil
+}
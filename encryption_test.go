@@ -0,0 +1,271 @@
+package excelinspect
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"unicode/utf16"
+)
+
+// compoundFile returns a version 3 compound file holding streams at its
+// root. Streams are padded with zeros to the 4096-byte mini stream cutoff,
+// so every one of them lives in regular sectors.
+func compoundFile(streams []struct {
+	name string
+	data []byte
+}) []byte {
+	const (
+		sectorSize = 512
+		freeSect   = 0xFFFFFFFF
+		endOfChain = 0xFFFFFFFE
+		fatSect    = 0xFFFFFFFD
+		noStream   = 0xFFFFFFFF
+	)
+	dirSectors := (len(streams) + 1 + 3) / 4
+	var dataSectors int
+	for idx := range streams {
+		if len(streams[idx].data) < 4096 {
+			streams[idx].data = append(streams[idx].data, make([]byte, 4096-len(streams[idx].data))...)
+		}
+		dataSectors += (len(streams[idx].data) + sectorSize - 1) / sectorSize
+	}
+	fatSectors := 1
+	for fatSectors*sectorSize/4 < fatSectors+dirSectors+dataSectors {
+		fatSectors++
+	}
+
+	fat := make([]uint32, fatSectors*sectorSize/4)
+	for idx := range fat {
+		fat[idx] = freeSect
+	}
+	next := 0
+	chain := func(n int) int {
+		first := next
+		for idx := 0; idx < n; idx++ {
+			fat[next] = uint32(next + 1)
+			next++
+		}
+		fat[next-1] = endOfChain
+		return first
+	}
+	for idx := 0; idx < fatSectors; idx++ {
+		fat[next] = fatSect
+		next++
+	}
+	dirStart := chain(dirSectors)
+
+	dir := make([]byte, dirSectors*sectorSize)
+	entry := func(idx int, name string, typ byte, right, child uint32, start, size int) {
+		e := dir[idx*128:]
+		units := utf16.Encode([]rune(name))
+		for i, u := range units {
+			binary.LittleEndian.PutUint16(e[2*i:], u)
+		}
+		binary.LittleEndian.PutUint16(e[64:], uint16(2*len(units)+2))
+		e[66], e[67] = typ, 1
+		binary.LittleEndian.PutUint32(e[68:], noStream)
+		binary.LittleEndian.PutUint32(e[72:], right)
+		binary.LittleEndian.PutUint32(e[76:], child)
+		binary.LittleEndian.PutUint32(e[116:], uint32(start))
+		binary.LittleEndian.PutUint64(e[120:], uint64(size))
+	}
+	for idx := 0; idx < dirSectors*4; idx++ {
+		entry(idx, "", 0, noStream, noStream, 0, 0)
+	}
+	entry(0, "Root Entry", 5, noStream, 1, endOfChain, 0)
+	var body []byte
+	for idx, s := range streams {
+		right := uint32(noStream)
+		if idx+1 < len(streams) {
+			right = uint32(idx + 2)
+		}
+		n := (len(s.data) + sectorSize - 1) / sectorSize
+		entry(idx+1, s.name, 2, right, noStream, chain(n), len(s.data))
+		body = append(body, s.data...)
+		body = append(body, make([]byte, n*sectorSize-len(s.data))...)
+	}
+
+	header := make([]byte, sectorSize)
+	copy(header, cfbSignature)
+	binary.LittleEndian.PutUint16(header[24:], 0x003E)
+	binary.LittleEndian.PutUint16(header[26:], 3)
+	binary.LittleEndian.PutUint16(header[28:], 0xFFFE)
+	binary.LittleEndian.PutUint16(header[30:], 9)
+	binary.LittleEndian.PutUint16(header[32:], 6)
+	binary.LittleEndian.PutUint32(header[44:], uint32(fatSectors))
+	binary.LittleEndian.PutUint32(header[48:], uint32(dirStart))
+	binary.LittleEndian.PutUint32(header[56:], 4096)
+	binary.LittleEndian.PutUint32(header[60:], endOfChain)
+	binary.LittleEndian.PutUint32(header[68:], endOfChain)
+	for idx := 0; idx < 109; idx++ {
+		v := uint32(freeSect)
+		if idx < fatSectors {
+			v = uint32(idx)
+		}
+		binary.LittleEndian.PutUint32(header[76+4*idx:], v)
+	}
+
+	out := bytes.NewBuffer(header)
+	binary.Write(out, binary.LittleEndian, fat)
+	out.Write(dir)
+	out.Write(body)
+	return out.Bytes()
+}
+
+// encryptedPackage wraps an encrypted package in a compound file with its
+// EncryptionInfo stream.
+func encryptedPackage(info, pkg []byte) []byte {
+	return compoundFile([]struct {
+		name string
+		data []byte
+	}{
+		{"EncryptionInfo", info},
+		{"EncryptedPackage", pkg},
+	})
+}
+
+func padBlocks(b []byte) []byte {
+	if n := len(b) % aes.BlockSize; n != 0 {
+		b = append(b, make([]byte, aes.BlockSize-n)...)
+	}
+	return b
+}
+
+func encryptCBC(key, iv, data []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	data = padBlocks(append([]byte(nil), data...))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return data
+}
+
+// agileEncrypt encrypts pkg with Agile encryption (AES-256, SHA-512) under
+// password, returning the EncryptionInfo and EncryptedPackage streams.
+func agileEncrypt(pkg []byte, password string) (info, enc []byte) {
+	const spinCount = 1000
+	keySalt := []byte("0123456789abcdef")
+	dataSalt := []byte("fedcba9876543210")
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	verifier := []byte("verifier-input!!")
+
+	sum := hashPassword(sha512.New, keySalt, password, spinCount)
+	encryptField := func(blockKey, data []byte) string {
+		h := sha512.New()
+		h.Write(sum)
+		h.Write(blockKey)
+		key := fitLength(h.Sum(nil), 32, 0x36)
+		return base64.StdEncoding.EncodeToString(encryptCBC(key, keySalt, data))
+	}
+	verifierHash := sha512.Sum512(verifier)
+
+	enc = binary.LittleEndian.AppendUint64(nil, uint64(len(pkg)))
+	var segment [4]byte
+	for idx, off := 0, 0; off < len(pkg); idx, off = idx+1, off+4096 {
+		binary.LittleEndian.PutUint32(segment[:], uint32(idx))
+		h := sha512.New()
+		h.Write(dataSalt)
+		h.Write(segment[:])
+		enc = append(enc, encryptCBC(secret, fitLength(h.Sum(nil), 16, 0x36), pkg[off:min(off+4096, len(pkg))])...)
+	}
+
+	params := `blockSize="16" keyBits="256" hashSize="64" cipherAlgorithm="AES" cipherChaining="ChainingModeCBC" hashAlgorithm="SHA512"`
+	desc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<encryption xmlns="http://schemas.microsoft.com/office/2006/encryption" xmlns:p="http://schemas.microsoft.com/office/2006/keyEncryptor/password"><keyData saltSize="16" saltValue="%s" %s/><keyEncryptors><keyEncryptor uri="http://schemas.microsoft.com/office/2006/keyEncryptor/password"><p:encryptedKey spinCount="%d" saltSize="16" saltValue="%s" %s encryptedVerifierHashInput="%s" encryptedVerifierHashValue="%s" encryptedKeyValue="%s"/></keyEncryptor></keyEncryptors></encryption>`,
+		base64.StdEncoding.EncodeToString(dataSalt), params,
+		spinCount, base64.StdEncoding.EncodeToString(keySalt), params,
+		encryptField(agileVerifierInputKey, verifier),
+		encryptField(agileVerifierValueKey, verifierHash[:]),
+		encryptField(agileSecretKey, secret))
+	info = append(u16(4, 4, 0x40, 0), desc...)
+	return info, enc
+}
+
+// standardEncrypt encrypts pkg with Standard encryption (AES-128) under
+// password, returning the EncryptionInfo and EncryptedPackage streams.
+func standardEncrypt(pkg []byte, password string) (info, enc []byte) {
+	salt := []byte("0123456789abcdef")
+	verifier := []byte("verifier-input!!")
+	block, _ := aes.NewCipher(standardKey(salt, password, 128))
+	encryptECB := func(data []byte) []byte {
+		out := padBlocks(append([]byte(nil), data...))
+		for off := 0; off < len(out); off += aes.BlockSize {
+			block.Encrypt(out[off:], out[off:])
+		}
+		return out
+	}
+	verifierHash := sha1.Sum(verifier)
+
+	header := make([]byte, 32)
+	binary.LittleEndian.PutUint32(header[8:], 0x660E) // AES-128
+	binary.LittleEndian.PutUint32(header[12:], 0x8004)
+	binary.LittleEndian.PutUint32(header[16:], 128)
+	info = u16(3, 2, 0x24, 0)
+	info = binary.LittleEndian.AppendUint32(info, uint32(len(header)))
+	info = append(info, header...)
+	info = binary.LittleEndian.AppendUint32(info, 16)
+	info = append(info, salt...)
+	info = append(info, encryptECB(verifier)...)
+	info = binary.LittleEndian.AppendUint32(info, sha1.Size)
+	info = append(info, encryptECB(verifierHash[:])...)
+
+	enc = binary.LittleEndian.AppendUint64(nil, uint64(len(pkg)))
+	return info, append(enc, encryptECB(pkg)...)
+}
+
+// agileSpinCount returns an Agile encryptor whose spin count is replaced
+// with spinCount after encryption.
+func agileSpinCount(spinCount string) func([]byte, string) ([]byte, []byte) {
+	return func(pkg []byte, password string) ([]byte, []byte) {
+		info, enc := agileEncrypt(pkg, password)
+		return bytes.Replace(info, []byte(`spinCount="1000"`), []byte(`spinCount="`+spinCount+`"`), 1), enc
+	}
+}
+
+func TestEncryptedWorkbook(t *testing.T) {
+	pkg := benchWorkbook(t, 20)
+	tests := []struct {
+		name     string
+		encrypt  func([]byte, string) ([]byte, []byte)
+		key      string
+		password string
+		wantErr  error
+	}{
+		{"agile", agileEncrypt, "secret", "secret", nil},
+		{"agile missing password", agileEncrypt, "secret", "", ErrPasswordRequired},
+		{"agile wrong password", agileEncrypt, "secret", "guess", ErrWrongPassword},
+		{"agile default password", agileEncrypt, defaultPassword, "", nil},
+		{"agile huge spin count", agileSpinCount("2000000000"), "secret", "secret", ErrUnsupportedEncryption},
+		{"agile negative spin count", agileSpinCount("-1"), "secret", "secret", ErrUnsupportedEncryption},
+		{"standard", standardEncrypt, "secret", "secret", nil},
+		{"standard missing password", standardEncrypt, "secret", "", ErrPasswordRequired},
+		{"standard wrong password", standardEncrypt, "secret", "guess", ErrWrongPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ins, err := NewFromBytes(encryptedPackage(tt.encrypt(pkg, tt.key)), WithPassword(tt.password))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ins.Close()
+			info, err := ins.Inspect()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(info.Sheets) != 1 || info.Sheets[0].Name != "Inventory" || info.Sheets[0].RowCount != 22 {
+				t.Errorf("sheets = %+v, want Inventory with 22 rows", info.Sheets)
+			}
+		})
+	}
+}
@@ -52,7 +52,10 @@ func main() {
 		fmt.Printf("  - %s: %d rows, %d cols\n", s.Name, s.RowCount, s.ColumnCount)
 	}
 
-	markdownOut := ins.MarkdownFromInfo(info, true)
+	markdownOut, err := ins.MarkdownFromInfo(info, true)
+	if err != nil {
+		log.Fatalf("Failed to render Markdown: %v", err)
+	}
 	if err := os.WriteFile(outPath, []byte(markdownOut), 0o644); err != nil {
 		log.Fatalf("Failed to write %s: %v", outPath, err)
 	}
@@ -0,0 +1,644 @@
+package excelinspect
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Dependency is one edge of the workbook's formula dependency graph: the
+// formula cells in From, a run of one column, read the cells in To. Ranges
+// are in A1 notation; whole columns read as "A:C" and whole rows as "5:9".
+// Only the rows scanned for details are taken into account.
+type Dependency struct {
+	FromSheet string `json:"from_sheet"`
+	From      string `json:"from"`
+	ToSheet   string `json:"to_sheet"`
+	To        string `json:"to"`
+	Cells     int    `json:"cells"`
+}
+
+// formula is a cell formula in R1C1 notation: references are offsets from
+// the formula's cell unless absolute, so a formula filled down or across
+// reads the same in every cell. refs are its references in the same terms.
+type formula struct {
+	text string
+	refs []formulaRef
+}
+
+// opaqueFormula marks a cell known to hold a formula whose text is not read,
+// as in .xls files, where formulas are stored compiled.
+var opaqueFormula = &formula{}
+
+// refPoint is one corner of a reference. row (1-based) and col (0-based) are
+// offsets from the formula's cell unless marked absolute.
+type refPoint struct {
+	row, col       int
+	rowAbs, colAbs bool
+}
+
+// formulaRef is a reference of a formula to a cell, when first and last are
+// the same, or a range. Whole-column references (A:C) have no rows and
+// whole-row references (5:9) no columns. sheet is "" for the formula's own
+// sheet.
+type formulaRef struct {
+	sheet       string
+	first, last refPoint
+	wholeCols   bool
+	wholeRows   bool
+}
+
+// r1c1 writes the reference as Excel's R1C1 notation does.
+func (r formulaRef) r1c1(b *strings.Builder) {
+	if r.sheet != "" {
+		b.WriteString(quoteSheetName(r.sheet))
+		b.WriteByte('!')
+	}
+	point := func(p refPoint) {
+		if !r.wholeCols {
+			b.WriteString(r1c1Part('R', p.row, p.rowAbs))
+		}
+		if !r.wholeRows {
+			b.WriteString(r1c1Part('C', p.col, p.colAbs))
+		}
+	}
+	point(r.first)
+	if r.last != r.first {
+		b.WriteByte(':')
+		point(r.last)
+	}
+}
+
+// r1c1Part formats a row or column of an R1C1 reference. Absolute columns
+// are 1-based there, like rows.
+func r1c1Part(axis byte, v int, abs bool) string {
+	switch {
+	case abs && axis == 'C':
+		return "C" + strconv.Itoa(v+1)
+	case abs:
+		return "R" + strconv.Itoa(v)
+	case v == 0:
+		return string(axis)
+	}
+	return fmt.Sprintf("%c[%d]", axis, v)
+}
+
+// refArea is a reference resolved for one formula cell: 1-based rows and
+// 0-based columns.
+type refArea struct {
+	sheet                    string
+	top, left, bottom, right int
+	wholeCols, wholeRows     bool
+}
+
+// resolve returns the cells r refers to from the formula cell at row, col.
+func (r formulaRef) resolve(row, col int) refArea {
+	abs := func(p refPoint) (int, int) {
+		pr, pc := p.row, p.col
+		if !p.rowAbs {
+			pr += row
+		}
+		if !p.colAbs {
+			pc += col
+		}
+		return pr, pc
+	}
+	r1, c1 := abs(r.first)
+	r2, c2 := abs(r.last)
+	return refArea{
+		sheet:     r.sheet,
+		top:       min(r1, r2),
+		left:      min(c1, c2),
+		bottom:    max(r1, r2),
+		right:     max(c1, c2),
+		wholeCols: r.wholeCols,
+		wholeRows: r.wholeRows,
+	}
+}
+
+func (a refArea) union(b refArea) refArea {
+	a.top, a.left = min(a.top, b.top), min(a.left, b.left)
+	a.bottom, a.right = max(a.bottom, b.bottom), max(a.right, b.right)
+	return a
+}
+
+// a1 formats the area in A1 notation, without its sheet.
+func (a refArea) a1() string {
+	switch {
+	case a.wholeCols:
+		return columnLetter(a.left) + ":" + columnLetter(a.right)
+	case a.wholeRows:
+		return strconv.Itoa(a.top) + ":" + strconv.Itoa(a.bottom)
+	case a.top == a.bottom && a.left == a.right:
+		return columnLetter(a.left) + strconv.Itoa(a.top)
+	}
+	return columnLetter(a.left) + strconv.Itoa(a.top) + ":" + columnLetter(a.right) + strconv.Itoa(a.bottom)
+}
+
+// quoteSheetName quotes a sheet name for a reference when it is not a plain
+// word.
+func quoteSheetName(name string) string {
+	plain := name != "" && (name[0] < '0' || name[0] > '9')
+	for _, c := range name {
+		if !(c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return name
+	}
+	return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+}
+
+// parseA1Formula converts a formula as .xlsx files store it (A1 notation,
+// without the leading "=") in the cell at row (1-based), col (0-based) to
+// R1C1. String literals, function names, defined names and structured table
+// references are kept as they are.
+func parseA1Formula(src string, row, col int) *formula {
+	f := &formula{}
+	var b strings.Builder
+	b.WriteByte('=')
+	// book is an external workbook index such as "[1]", which belongs to the
+	// sheet name after it.
+	book := ""
+	emitRef := func(sheet string, rest string) (int, bool) {
+		ref, n, ok := parseA1Ref(rest, row, col)
+		if !ok {
+			return 0, false
+		}
+		ref.sheet = sheet
+		ref.r1c1(&b)
+		f.refs = append(f.refs, ref)
+		return n, true
+	}
+	for pos := 0; pos < len(src); {
+		c := src[pos]
+		switch {
+		case c == '"':
+			end := skipQuoted(src, pos)
+			b.WriteString(src[pos:end])
+			pos = end
+		case c == '\'':
+			end := skipQuoted(src, pos)
+			if end < len(src) && src[end] == '!' {
+				sheet := book + strings.ReplaceAll(src[pos+1:end-1], "''", "'")
+				if n, ok := emitRef(sheet, src[end+1:]); ok {
+					pos = end + 1 + n
+					book = ""
+					continue
+				}
+			}
+			b.WriteString(src[pos:end])
+			pos = end
+		case c == '[':
+			end := skipBrackets(src, pos)
+			if idx := src[pos+1 : max(pos+1, end-1)]; idx != "" && strings.Trim(idx, "0123456789") == "" {
+				book = src[pos:end]
+				pos = end
+				continue
+			}
+			b.WriteString(src[pos:end])
+			pos = end
+		case isFormulaNameChar(c):
+			end := pos
+			for end < len(src) && isFormulaNameChar(src[end]) {
+				end++
+			}
+			word := src[pos:end]
+			if end < len(src) && src[end] == '!' {
+				if n, ok := emitRef(book+word, src[end+1:]); ok {
+					pos = end + 1 + n
+					book = ""
+					continue
+				}
+			}
+			if end < len(src) && src[end] == '(' {
+				b.WriteString(word)
+				pos = end
+				continue
+			}
+			if n, ok := emitRef("", src[pos:]); ok {
+				pos += n
+				continue
+			}
+			b.WriteString(book + word)
+			book = ""
+			pos = end
+		default:
+			b.WriteByte(c)
+			pos++
+		}
+	}
+	f.text = b.String()
+	return f
+}
+
+// parseODSFormula converts an OpenFormula expression as .ods files store it
+// ("of:=[.A1]*2") in the cell at row, col to the R1C1 notation of Excel
+// formulas: references lose their brackets and function arguments are
+// separated by commas.
+func parseODSFormula(src string, row, col int) *formula {
+	if ns, rest, ok := strings.Cut(src, ":="); ok && !strings.ContainsAny(ns, `"[(`) {
+		if ns == "msoxl" {
+			return parseA1Formula(rest, row, col)
+		}
+		src = rest
+	} else {
+		src = strings.TrimPrefix(src, "=")
+	}
+	f := &formula{}
+	var b strings.Builder
+	b.WriteByte('=')
+	for pos := 0; pos < len(src); {
+		switch c := src[pos]; c {
+		case '"':
+			end := skipQuoted(src, pos)
+			b.WriteString(src[pos:end])
+			pos = end
+		case '[':
+			end := skipBrackets(src, pos)
+			if ref, ok := parseODSRef(src[pos+1:max(pos+1, end-1)], row, col); ok {
+				ref.r1c1(&b)
+				f.refs = append(f.refs, ref)
+			} else {
+				b.WriteString(src[pos:end])
+			}
+			pos = end
+		case ';':
+			b.WriteByte(',')
+			pos++
+		default:
+			b.WriteByte(c)
+			pos++
+		}
+	}
+	f.text = b.String()
+	return f
+}
+
+// parseODSRef reads the inside of an OpenFormula reference: ".A1",
+// "$Sheet1.$A$1:.B2" or "'My Sheet'.A:.C". Only the first sheet of a 3D
+// range is kept.
+func parseODSRef(s string, row, col int) (formulaRef, bool) {
+	var ref formulaRef
+	var points [2]string
+	parts := 0
+	for start, pos := 0, 0; pos <= len(s); pos++ {
+		if pos < len(s) && s[pos] == '\'' {
+			pos = skipQuoted(s, pos) - 1
+			continue
+		}
+		if pos < len(s) && s[pos] != ':' {
+			continue
+		}
+		if parts == 2 {
+			return ref, false
+		}
+		part := s[start:pos]
+		dot := strings.LastIndexByte(part, '.')
+		if dot < 0 {
+			return ref, false
+		}
+		if sheet := strings.TrimPrefix(part[:dot], "$"); sheet != "" && parts == 0 {
+			if strings.HasPrefix(sheet, "'") {
+				sheet = strings.ReplaceAll(strings.Trim(sheet, "'"), "''", "'")
+			}
+			ref.sheet = sheet
+		}
+		points[parts] = part[dot+1:]
+		parts++
+		start = pos + 1
+	}
+	text := points[0]
+	if parts == 2 {
+		text += ":" + points[1]
+	}
+	parsed, n, ok := parseA1Ref(text, row, col)
+	if !ok || n != len(text) {
+		return ref, false
+	}
+	parsed.sheet = ref.sheet
+	return parsed, true
+}
+
+// parseA1Ref reads an A1 reference at the start of s: a cell, a range of
+// cells, whole columns (A:C) or whole rows (5:9), each part optionally
+// absolute with "$". It returns the reference relative to the cell at row,
+// col and the length read.
+func parseA1Ref(s string, row, col int) (formulaRef, int, bool) {
+	first, kind, n := parseA1Point(s)
+	if kind == 0 {
+		return formulaRef{}, 0, false
+	}
+	ref := formulaRef{first: first, last: first}
+	if n < len(s) && s[n] == ':' {
+		if last, lastKind, m := parseA1Point(s[n+1:]); lastKind == kind {
+			ref.last = last
+			n += 1 + m
+		} else if kind != 'c' {
+			return formulaRef{}, 0, false
+		}
+	} else if kind != 'c' {
+		return formulaRef{}, 0, false
+	}
+	if n < len(s) && (isFormulaNameChar(s[n]) || s[n] == '(' || s[n] == '!') {
+		return formulaRef{}, 0, false
+	}
+	ref.wholeCols = kind == 'C'
+	ref.wholeRows = kind == 'R'
+	for _, p := range []*refPoint{&ref.first, &ref.last} {
+		if !p.rowAbs {
+			p.row -= row
+		}
+		if !p.colAbs {
+			p.col -= col
+		}
+	}
+	if ref.wholeCols {
+		ref.first.row, ref.last.row = 0, 0
+	}
+	if ref.wholeRows {
+		ref.first.col, ref.last.col = 0, 0
+	}
+	return ref, n, true
+}
+
+// parseA1Point reads one corner of an A1 reference and returns its kind: 'c'
+// for a cell, 'C' for a column, 'R' for a row, or 0 when s does not start
+// with one.
+func parseA1Point(s string) (refPoint, byte, int) {
+	var p refPoint
+	pos := 0
+	colAbs := pos < len(s) && s[pos] == '$'
+	if colAbs {
+		pos++
+	}
+	letters := pos
+	for pos < len(s) && pos-letters < 4 && isASCIILetter(s[pos]) {
+		pos++
+	}
+	if pos-letters > 3 {
+		return p, 0, 0
+	}
+	colText := s[letters:pos]
+	rowAbs := false
+	if colText != "" && pos < len(s) && s[pos] == '$' {
+		rowAbs = true
+		pos++
+	} else if colText == "" && colAbs {
+		// "$5": an absolute row.
+		rowAbs, colAbs = true, false
+	}
+	digits := pos
+	for pos < len(s) && s[pos] >= '0' && s[pos] <= '9' {
+		pos++
+	}
+	rowText := s[digits:pos]
+	if colText != "" {
+		c, _, err := cellCoordinates(colText + "1")
+		if err != nil || c > 16383 {
+			return p, 0, 0
+		}
+		p.col, p.colAbs = c, colAbs
+	}
+	if rowText != "" {
+		r, err := strconv.Atoi(rowText)
+		if err != nil || r < 1 || r > 1048576 {
+			return p, 0, 0
+		}
+		p.row, p.rowAbs = r, rowAbs
+	}
+	switch {
+	case colText != "" && rowText != "":
+		return p, 'c', pos
+	case colText != "" && !rowAbs:
+		return p, 'C', pos
+	case rowText != "" && !colAbs:
+		return p, 'R', pos
+	}
+	return p, 0, 0
+}
+
+// skipQuoted returns the position after the string or quoted name that
+// starts at pos, where a doubled quote stands for one.
+func skipQuoted(s string, pos int) int {
+	q := s[pos]
+	for pos++; pos < len(s); pos++ {
+		if s[pos] != q {
+			continue
+		}
+		if pos+1 < len(s) && s[pos+1] == q {
+			pos++
+			continue
+		}
+		return pos + 1
+	}
+	return len(s)
+}
+
+// skipBrackets returns the position after the bracketed group that starts at
+// pos, which may nest, as structured references do.
+func skipBrackets(s string, pos int) int {
+	depth := 0
+	for ; pos < len(s); pos++ {
+		switch s[pos] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return pos + 1
+			}
+		case '\'':
+			// An escaped bracket in a structured reference.
+			pos++
+		}
+	}
+	return len(s)
+}
+
+func isFormulaNameChar(c byte) bool {
+	return c == '_' || c == '\\' || c == '.' || c == '$' || c >= '0' && c <= '9' || isASCIILetter(c) || c >= 0x80
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+// formulaStats gathers the formulas of one column: how many cells hold one,
+// how often each formula occurs, and the ranges on other sheets they read.
+type formulaStats struct {
+	count  int
+	texts  map[string]int
+	order  []string
+	cross  map[formulaRef]int
+	areas  []refArea
+	ownTab string
+}
+
+func newFormulaStats(sheet string) *formulaStats {
+	return &formulaStats{ownTab: sheet}
+}
+
+// add records the formula of the cell at row, col.
+func (s *formulaStats) add(f *formula, row, col int) {
+	if f == nil {
+		return
+	}
+	s.count++
+	if f.text == "" {
+		return
+	}
+	if s.texts == nil {
+		s.texts = make(map[string]int)
+	}
+	if s.texts[f.text] == 0 {
+		s.order = append(s.order, f.text)
+	}
+	s.texts[f.text]++
+	for _, ref := range f.refs {
+		if ref.sheet == "" || ref.sheet == s.ownTab {
+			continue
+		}
+		area := ref.resolve(row, col)
+		if s.cross == nil {
+			s.cross = make(map[formulaRef]int)
+		}
+		if idx, ok := s.cross[ref]; ok {
+			s.areas[idx] = s.areas[idx].union(area)
+			continue
+		}
+		s.cross[ref] = len(s.areas)
+		s.areas = append(s.areas, area)
+	}
+}
+
+// apply sets the formula fields of column c.
+func (s *formulaStats) apply(c *ColumnInfo) {
+	c.FormulaCount = s.count
+	best := 0
+	for _, text := range s.order {
+		if n := s.texts[text]; n > best {
+			c.Formula, best = text, n
+		}
+	}
+	c.CrossSheetRefs = nil
+	for _, a := range s.areas {
+		c.CrossSheetRefs = appendUnique(c.CrossSheetRefs, quoteSheetName(a.sheet)+"!"+a.a1())
+	}
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, existing := range list {
+		if existing == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// formulaDependencies returns the dependency graph edges of the formulas in
+// the scanned rows of a sheet: for each column, one edge per reference its
+// formulas make, from the rows holding them to the union of the cells they
+// read.
+func formulaDependencies(sheet string, d *sheetData) []Dependency {
+	type edgeKey struct {
+		col int
+		ref formulaRef
+	}
+	type edge struct {
+		top, bottom int
+		area        refArea
+		cells       int
+	}
+	var keys []edgeKey
+	edges := make(map[edgeKey]*edge)
+	for r, row := range d.formulas {
+		for c, f := range row {
+			if f == nil {
+				continue
+			}
+			for _, ref := range f.refs {
+				key := edgeKey{col: c, ref: ref}
+				area := ref.resolve(r+1, c)
+				if e, ok := edges[key]; ok {
+					e.bottom = r + 1
+					e.area = e.area.union(area)
+					e.cells++
+					continue
+				}
+				keys = append(keys, key)
+				edges[key] = &edge{top: r + 1, bottom: r + 1, area: area, cells: 1}
+			}
+		}
+	}
+
+	var out []Dependency
+	index := make(map[Dependency]int)
+	for _, key := range keys {
+		e := edges[key]
+		from := refArea{top: e.top, bottom: e.bottom, left: key.col, right: key.col}
+		dep := Dependency{
+			FromSheet: sheet,
+			From:      from.a1(),
+			ToSheet:   e.area.sheet,
+			To:        e.area.a1(),
+		}
+		if dep.ToSheet == "" {
+			dep.ToSheet = sheet
+		}
+		if idx, ok := index[dep]; ok {
+			out[idx].Cells += e.cells
+			continue
+		}
+		index[dep] = len(out)
+		dep.Cells = e.cells
+		out = append(out, dep)
+	}
+	return out
+}
+
+// WriteDependencyDOT writes the formula dependency graph of info, as
+// InspectWithDetails builds it, in Graphviz DOT format. Ranges are grouped
+// by sheet, and each edge points from formula cells to the cells they read,
+// labelled with the number of formula cells.
+func WriteDependencyDOT(w io.Writer, info *FileInfo) error {
+	b := newRenderWriter(w)
+	b.WriteString("digraph dependencies {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+
+	var sheets []string
+	ranges := make(map[string][]string)
+	addNode := func(sheet, rng string) {
+		if _, ok := ranges[sheet]; !ok {
+			sheets = append(sheets, sheet)
+		}
+		ranges[sheet] = appendUnique(ranges[sheet], rng)
+	}
+	for _, dep := range info.Dependencies {
+		addNode(dep.FromSheet, dep.From)
+		addNode(dep.ToSheet, dep.To)
+	}
+	for idx, sheet := range sheets {
+		b.WriteString(fmt.Sprintf("  subgraph cluster_%d {\n", idx))
+		b.WriteString(fmt.Sprintf("    label=%s;\n", dotQuote(sheet)))
+		for _, rng := range ranges[sheet] {
+			b.WriteString(fmt.Sprintf("    %s [label=%s];\n", dotQuote(sheet+"!"+rng), dotQuote(rng)))
+		}
+		b.WriteString("  }\n")
+	}
+	for _, dep := range info.Dependencies {
+		b.WriteString(fmt.Sprintf("  %s -> %s [label=\"%d\"];\n",
+			dotQuote(dep.FromSheet+"!"+dep.From), dotQuote(dep.ToSheet+"!"+dep.To), dep.Cells))
+	}
+	b.WriteString("}\n")
+	return b.flush()
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
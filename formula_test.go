@@ -0,0 +1,61 @@
+package excelinspect
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseA1Formula(t *testing.T) {
+	tests := []struct {
+		src      string
+		row, col int
+		want     string
+		areas    []string
+	}{
+		{"B2*C2", 2, 3, "=RC[-2]*RC[-1]", []string{"B2", "C2"}},
+		{"$A$1+A$1+$A1", 3, 1, "=R1C1+R1C[-1]+R[-2]C1", []string{"A1", "A1", "A1"}},
+		{"SUM(A:A)+SUM(2:3)", 5, 2, "=SUM(C[-2])+SUM(R[-3]:R[-2])", []string{"A:A", "2:3"}},
+		{"'Price List'!A2:B40", 2, 0, "='Price List'!RC:R[38]C[1]", []string{"'Price List'!A2:B40"}},
+		{"SUM(Sheet2!$B$5,[1]Data!C3)", 4, 0, "=SUM(Sheet2!R5C2,'[1]Data'!R[-1]C[2])", []string{"Sheet2!B5", "'[1]Data'!C3"}},
+		{`SUM(Table1[Amount])&"A1"`, 2, 0, `=SUM(Table1[Amount])&"A1"`, nil},
+		{"IF(A2>0,TRUE,FALSE)", 2, 1, "=IF(RC[-1]>0,TRUE,FALSE)", []string{"A2"}},
+		{"Rate*A2", 2, 1, "=Rate*RC[-1]", []string{"A2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			f := parseA1Formula(tt.src, tt.row, tt.col)
+			if f.text != tt.want {
+				t.Errorf("text = %q, want %q", f.text, tt.want)
+			}
+			var areas []string
+			for _, ref := range f.refs {
+				area := ref.resolve(tt.row, tt.col)
+				if area.sheet != "" {
+					areas = append(areas, quoteSheetName(area.sheet)+"!"+area.a1())
+				} else {
+					areas = append(areas, area.a1())
+				}
+			}
+			if !reflect.DeepEqual(areas, tt.areas) {
+				t.Errorf("areas = %q, want %q", areas, tt.areas)
+			}
+		})
+	}
+}
+
+func TestParseODSFormula(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"of:=SUM([.A1:.B2];[$Sheet2.$C$3])*2", "=SUM(R[-2]C[-2]:R[-1]C[-1],Sheet2!R3C3)*2"},
+		{`of:=[.A1]&"x;y"`, `=R[-2]C[-2]&"x;y"`},
+		{"msoxl:=A1+1", "=R[-2]C[-2]+1"},
+	}
+	for _, tt := range tests {
+		// The formula's cell is C3.
+		if got := parseODSFormula(tt.src, 3, 2).text; got != tt.want {
+			t.Errorf("parseODSFormula(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -2,17 +2,10 @@ module excel-inspect
 
 go 1.25
 
-require github.com/xuri/excelize/v2 v2.8.0
-
 require (
-	github.com/mateuszkardas/toon-go v0.1.0 // indirect
-	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
-	github.com/richardlehane/mscfb v1.0.4 // indirect
-	github.com/richardlehane/msoleps v1.0.3 // indirect
-	github.com/thedatashed/xlsxreader v1.2.8 // indirect
-	github.com/xuri/efp v0.0.0-20230802181842-ad255f2331ca // indirect
-	github.com/xuri/nfp v0.0.0-20230819163627-dc951e3ffe1a // indirect
-	golang.org/x/crypto v0.12.0 // indirect
-	golang.org/x/net v0.14.0 // indirect
-	golang.org/x/text v0.12.0 // indirect
+	github.com/mateuszkardas/toon-go v0.1.0
+	github.com/richardlehane/mscfb v1.0.4
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/richardlehane/msoleps v1.0.3 // indirect
@@ -0,0 +1,177 @@
+package excelinspect
+
+import "strings"
+
+// maxHeaderBandRows is the deepest stacked header that is recognised.
+const maxHeaderBandRows = 3
+
+// headerBand is the run of rows forming a section header, with 0-based,
+// inclusive row indexes. Most headers are a single row; reports with merged
+// group labels such as "MARKET PRICE" over "CREDIT" and "CASH" span several.
+type headerBand struct {
+	top    int
+	bottom int
+}
+
+func (b headerBand) depth() int {
+	return b.bottom - b.top + 1
+}
+
+// headerBand grows the header row at headerIdx into a stacked band using the
+// sheet's merged cells: rows above it that hold merged parent labels, and rows
+// below it that only label columns under a merged parent. end is the 1-based
+// last row of the section; at least one data row is always left below.
+func (s *sheetScan) headerBand(headerIdx int, end int) headerBand {
+	band := headerBand{top: headerIdx, bottom: headerIdx}
+	if len(s.merges) == 0 {
+		return band
+	}
+	for band.depth() < maxHeaderBandRows && s.isParentHeaderRow(band.top-1, band) {
+		band.top--
+	}
+	for band.depth() < maxHeaderBandRows && band.bottom+1 < end-1 && s.isSubHeaderRow(band.bottom+1, band) {
+		band.bottom++
+	}
+	return band
+}
+
+// isParentHeaderRow reports whether row idx holds group labels for the band
+// below it. Every label must either start a merged range or sit above an empty
+// header cell, and a single label spanning the whole header is treated as a
+// title banner rather than a parent.
+func (s *sheetScan) isParentHeaderRow(idx int, band headerBand) bool {
+	if idx < 0 || !s.isTextRow(idx) {
+		return false
+	}
+	row := s.rows[idx]
+	below := s.rows[band.top]
+	merged := false
+	labels := 0
+	var banner mergeRange
+	for col, cell := range row {
+		if cell == "" {
+			continue
+		}
+		labels++
+		m, ok := s.mergeStartingAt(idx, col)
+		if ok && (m.right > m.left || m.bottom >= band.top) {
+			merged = true
+			banner = m
+			continue
+		}
+		if col < len(below) && below[col] != "" {
+			return false
+		}
+	}
+	if !merged {
+		return false
+	}
+	if labels == 1 && banner.top == banner.bottom {
+		coversHeader := true
+		for col, cell := range below {
+			if cell != "" && (col < banner.left || col > banner.right) {
+				coversHeader = false
+				break
+			}
+		}
+		if coversHeader {
+			return false
+		}
+	}
+	return true
+}
+
+// isSubHeaderRow reports whether row idx labels columns beneath merged parents
+// in the band above it. Every label must fall under a horizontal merge that
+// starts inside the band, which keeps ordinary data rows out.
+func (s *sheetScan) isSubHeaderRow(idx int, band headerBand) bool {
+	if idx >= len(s.rows) || !s.isTextRow(idx) {
+		return false
+	}
+	for col, cell := range s.rows[idx] {
+		if cell == "" {
+			continue
+		}
+		underParent := false
+		for _, m := range s.merges {
+			if m.top >= band.top && m.top <= band.bottom && m.bottom < idx && m.right > m.left && col >= m.left && col <= m.right {
+				underParent = true
+				break
+			}
+		}
+		if !underParent {
+			return false
+		}
+	}
+	return true
+}
+
+// isTextRow reports whether row idx is non-empty and holds only text.
+func (s *sheetScan) isTextRow(idx int) bool {
+	row := s.rows[idx]
+	if isEmptyRow(row) {
+		return false
+	}
+	for _, cell := range row {
+		if cell != "" && isDataValue(cell) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *sheetScan) mergeStartingAt(row, col int) (mergeRange, bool) {
+	for _, m := range s.merges {
+		if m.top == row && m.left == col {
+			return m, true
+		}
+	}
+	return mergeRange{}, false
+}
+
+// bandCell returns the label at (row, col), taking it from the top-left cell
+// of a merged range that starts inside the band when the cell is covered.
+func (s *sheetScan) bandCell(band headerBand, row, col int) string {
+	if col < len(s.rows[row]) && s.rows[row][col] != "" {
+		return s.rows[row][col]
+	}
+	for _, m := range s.merges {
+		if m.top < band.top || !m.contains(row, col) {
+			continue
+		}
+		if m.left < len(s.rows[m.top]) {
+			return s.rows[m.top][m.left]
+		}
+	}
+	return ""
+}
+
+// bandHeaders returns the column names of a band and, for stacked bands, each
+// column's label path from outermost to innermost. Names join the path with
+// " - ", so "MARKET PRICE" over "CREDIT" becomes "MARKET PRICE - CREDIT".
+func (s *sheetScan) bandHeaders(band headerBand) ([]string, [][]string) {
+	if band.depth() == 1 {
+		return trimTrailingEmpty(s.rows[band.top]), nil
+	}
+
+	width := 0
+	for row := band.top; row <= band.bottom; row++ {
+		width = max(width, len(s.rows[row]))
+	}
+	headers := make([]string, width)
+	paths := make([][]string, width)
+	for col := 0; col < width; col++ {
+		path := make([]string, 0, band.depth())
+		for row := band.top; row <= band.bottom; row++ {
+			v := s.bandCell(band, row, col)
+			if v == "" || (len(path) > 0 && path[len(path)-1] == v) {
+				continue
+			}
+			path = append(path, v)
+		}
+		headers[col] = strings.Join(path, " - ")
+		paths[col] = path
+	}
+	headers = trimTrailingEmpty(headers)
+	return headers, paths[:len(headers)]
+}
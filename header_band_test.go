@@ -0,0 +1,102 @@
+package excelinspect
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mergeCells encodes the mergeCells element of a worksheet.
+func mergeCells(refs ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<mergeCells count="%d">`, len(refs))
+	for _, ref := range refs {
+		fmt.Fprintf(&b, `<mergeCell ref="%s"/>`, ref)
+	}
+	b.WriteString("</mergeCells>")
+	return b.String()
+}
+
+func TestStackedHeaderBand(t *testing.T) {
+	data := xrow(3, 0, "1", "Toyota", "Avanza", "2019", "150000000", "140000000") +
+		xrow(4, 0, "2", "Honda", "Jazz", "2018", "170000000", "160000000")
+	stacked := []string{"NO", "MERK", "TYPE", "YEAR", "MARKET PRICE - CREDIT", "MARKET PRICE - CASH"}
+	stackedPaths := map[string][]string{
+		"MARKET PRICE - CREDIT": {"MARKET PRICE", "CREDIT"},
+		"MARKET PRICE - CASH":   {"MARKET PRICE", "CASH"},
+	}
+	tests := []struct {
+		name      string
+		rows      string
+		merges    []string
+		wantDepth int
+		headers   []string
+		paths     map[string][]string
+	}{
+		{
+			// The dictionary matches row 1; CREDIT and CASH below it sit
+			// under the merged MARKET PRICE.
+			name:      "sub-header row",
+			rows:      xrow(1, 0, "NO", "MERK", "TYPE", "YEAR", "MARKET PRICE") + xrow(2, 0, "", "", "", "", "CREDIT", "CASH") + data,
+			merges:    []string{"A1:A2", "B1:B2", "C1:C2", "D1:D2", "E1:F1"},
+			wantDepth: 2,
+			headers:   stacked,
+			paths:     stackedPaths,
+		},
+		{
+			// The dictionary matches row 2; the merged label above it is
+			// its parent.
+			name:      "parent row",
+			rows:      xrow(1, 0, "", "", "", "", "MARKET PRICE") + xrow(2, 0, "NO", "MERK", "TYPE", "YEAR", "CREDIT", "CASH") + data,
+			merges:    []string{"E1:F1"},
+			wantDepth: 2,
+			headers:   stacked,
+			paths:     stackedPaths,
+		},
+		{
+			// A single merged label across the whole header is a banner,
+			// not a parent.
+			name:      "title banner",
+			rows:      xrow(1, 0, "STOCK LIST") + xrow(2, 0, "NO", "MERK", "TYPE", "YEAR", "CREDIT", "CASH") + data,
+			merges:    []string{"A1:F1"},
+			wantDepth: 1,
+			headers:   []string{"NO", "MERK", "TYPE", "YEAR", "CREDIT", "CASH"},
+			paths:     map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet := testSheet{name: "Stock", rows: tt.rows, extra: mergeCells(tt.merges...)}
+			ins := openTestWorkbook(t, xlsxFile(t, []testSheet{sheet}, "", nil))
+			detail, err := ins.inspectSheetDetail(context.Background(), "Stock")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(detail.Sections) != 1 {
+				t.Fatalf("sections = %d, want 1", len(detail.Sections))
+			}
+			sec := detail.Sections[0]
+			if sec.HeaderDepth != tt.wantDepth || sec.HeaderRow != 2 || sec.StartRow != 3 {
+				t.Errorf("header depth %d, row %d, start %d, want %d, 2, 3", sec.HeaderDepth, sec.HeaderRow, sec.StartRow, tt.wantDepth)
+			}
+			if !reflect.DeepEqual(sec.Headers, tt.headers) {
+				t.Errorf("headers = %q, want %q", sec.Headers, tt.headers)
+			}
+			paths := map[string][]string{}
+			for _, c := range sec.Columns {
+				if c.HeaderPath != nil {
+					paths[c.Name] = c.HeaderPath
+				}
+			}
+			if !reflect.DeepEqual(paths, tt.paths) {
+				t.Errorf("header paths = %q, want %q", paths, tt.paths)
+			}
+			last := tt.headers[len(tt.headers)-1]
+			if len(sec.Rows) != 2 || sec.Rows[0].Values[last] != "140000000" {
+				t.Errorf("rows = %+v, want %s 140000000 first", sec.Rows, last)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package excelinspect
+
+import (
+	"math"
+	"strings"
+)
+
+// Weights of the signals combined by scoreHeaderRow. They sum to 1, so the
+// weighted average can be read as a confidence between 0 and 1.
+const (
+	headerWeightFill     = 0.25
+	headerWeightText     = 0.20
+	headerWeightContrast = 0.20
+	headerWeightUnique   = 0.15
+	headerWeightStyle    = 0.10
+	headerWeightFirst    = 0.10
+)
+
+const (
+	// headerCandidateRows is how many leading non-empty rows of a table are
+	// considered as its header.
+	headerCandidateRows = 10
+	// headerLookahead is how many rows below a candidate are compared with it.
+	headerLookahead = 20
+	// minHeaderScore is the lowest score accepted as a header.
+	minHeaderScore = 0.5
+)
+
+// cellStyleProbe reports whether the cell at a 1-based row and 0-based column
+// is styled like a header. A nil probe means no styling is available.
+type cellStyleProbe func(row, col int) bool
+
+// tableBlock is a run of rows separated from its neighbours by at least two
+// blank rows. start and end are 0-based row indexes, end exclusive.
+type tableBlock struct {
+	start int
+	end   int
+}
+
+// splitTableBlocks splits rows into tables on runs of two or more blank rows,
+// the same gap extractSectionsByHeuristic treats as the end of a section.
+func splitTableBlocks(rows [][]string) []tableBlock {
+	blocks := make([]tableBlock, 0)
+	start := -1
+	lastNonEmpty := -1
+	for idx := 0; idx < len(rows); idx++ {
+		if isEmptyRow(rows[idx]) {
+			if start >= 0 && hasConsecutiveBlankRows(rows, idx, 2) {
+				blocks = append(blocks, tableBlock{start: start, end: lastNonEmpty + 1})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = idx
+		}
+		lastNonEmpty = idx
+	}
+	if start >= 0 {
+		blocks = append(blocks, tableBlock{start: start, end: lastNonEmpty + 1})
+	}
+	return blocks
+}
+
+// extractSectionsByScore finds one header row per table without relying on a
+// vocabulary. Each table's leading rows are scored with scoreHeaderRow and the
+// best one at or above minHeaderScore becomes the section header.
+func (d *detector) extractSectionsByScore(scan *sheetScan, styled cellStyleProbe) []Section {
+	rows := scan.rows
+	sections := make([]Section, 0)
+	for _, block := range splitTableBlocks(rows) {
+		headerIdx, score := bestHeaderRow(rows, block, styled)
+		if headerIdx < 0 {
+			continue
+		}
+
+		band := scan.headerBand(headerIdx, block.end)
+		title := ""
+		for above := band.top - 1; above >= block.start; above-- {
+			if !isEmptyRow(rows[above]) {
+				title = d.sectionTitleFromRow(scan.titleRow(above))
+				break
+			}
+		}
+		sections = append(sections, scan.newSection(band, title, block.end, score))
+	}
+	return sections
+}
+
+// bestHeaderRow returns the 0-based index and score of the best header
+// candidate in block, or -1 when no candidate reaches minHeaderScore.
+func bestHeaderRow(rows [][]string, block tableBlock, styled cellStyleProbe) (int, float64) {
+	width := 0
+	for idx := block.start; idx < block.end; idx++ {
+		width = max(width, len(trimTrailingEmpty(rows[idx])))
+	}
+
+	bestIdx, bestScore := -1, 0.0
+	seenDense := false
+	candidates := 0
+	for idx := block.start; idx < block.end && candidates < headerCandidateRows; idx++ {
+		row := trimTrailingEmpty(rows[idx])
+		if len(row) == 0 {
+			continue
+		}
+		candidates++
+		firstDense := false
+		if !seenDense && width > 0 && float64(countNonEmpty(row))/float64(width) >= 0.5 {
+			firstDense = true
+			seenDense = true
+		}
+		score := scoreHeaderRow(rows, idx, block, firstDense, styled)
+		if score > bestScore {
+			bestIdx, bestScore = idx, score
+		}
+	}
+	if bestScore < minHeaderScore {
+		return -1, 0
+	}
+	return bestIdx, math.Round(bestScore*1000) / 1000
+}
+
+// scoreHeaderRow rates how much rows[idx] looks like the header of the table
+// below it, combining:
+//
+//   - fill: share of the table's width the row covers
+//   - text: share of its cells that are text rather than numbers or dates
+//   - contrast: how often the columns it labels hold non-text data below
+//   - uniqueness: share of distinct values among its cells
+//   - style: share of its cells that are bold or bordered
+//   - first: whether it is the first dense row of the table
+//
+// Rows with fewer than two values or no data below score zero.
+func scoreHeaderRow(rows [][]string, idx int, block tableBlock, firstDense bool, styled cellStyleProbe) float64 {
+	row := trimTrailingEmpty(rows[idx])
+	nonEmpty := countNonEmpty(row)
+	if nonEmpty < 2 {
+		return 0
+	}
+
+	lookEnd := min(block.end, idx+1+headerLookahead)
+	width := len(row)
+	dataRows := 0
+	for below := idx + 1; below < lookEnd; below++ {
+		trimmed := trimTrailingEmpty(rows[below])
+		if len(trimmed) == 0 {
+			continue
+		}
+		dataRows++
+		width = max(width, len(trimmed))
+	}
+	if dataRows == 0 {
+		return 0
+	}
+
+	text := 0
+	styledCells := 0
+	distinct := make(map[string]bool, nonEmpty)
+	contrastSum := 0.0
+	contrastCols := 0
+	for col, cell := range row {
+		if cell == "" {
+			continue
+		}
+		distinct[strings.ToUpper(cell)] = true
+		if styled != nil && styled(idx+1, col) {
+			styledCells++
+		}
+		if isDataValue(cell) {
+			continue
+		}
+		text++
+
+		filled, data := 0, 0
+		for below := idx + 1; below < lookEnd; below++ {
+			if col >= len(rows[below]) || rows[below][col] == "" {
+				continue
+			}
+			filled++
+			if isDataValue(rows[below][col]) {
+				data++
+			}
+		}
+		if filled > 0 {
+			contrastCols++
+			contrastSum += float64(data) / float64(filled)
+		}
+	}
+
+	score := headerWeightFill*float64(nonEmpty)/float64(width) +
+		headerWeightText*float64(text)/float64(nonEmpty) +
+		headerWeightUnique*float64(len(distinct))/float64(nonEmpty)
+	totalWeight := headerWeightFill + headerWeightText + headerWeightUnique + headerWeightContrast + headerWeightFirst
+	if contrastCols > 0 {
+		score += headerWeightContrast * contrastSum / float64(contrastCols)
+	}
+	if firstDense {
+		score += headerWeightFirst
+	}
+	// Without styling information the style signal is left out rather than
+	// counted as "not styled".
+	if styled != nil {
+		score += headerWeightStyle * float64(styledCells) / float64(nonEmpty)
+		totalWeight += headerWeightStyle
+	}
+	return score / totalWeight
+}
+
+// isDataValue reports whether a cell holds a typed value (a number, date,
+// boolean and so on) rather than text.
+func isDataValue(v string) bool {
+	t := inferTextType(strings.TrimSpace(v))
+	return t != DataTypeString && t != DataTypeEmpty
+}
+
+func countNonEmpty(row []string) int {
+	n := 0
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// headerStyleProbe returns a cellStyleProbe backed by the scanned cells'
+// styles: a cell counts as header-styled when its font is bold or it has a
+// bottom border.
+func (s *sheetScan) headerStyleProbe() cellStyleProbe {
+	return func(row, col int) bool {
+		return s.markAt(row, col)&markHeaderStyle != 0
+	}
+}
+
+// markAt returns the marks of the cell at a 1-based row and 0-based column.
+func (s *sheetScan) markAt(row, col int) cellMark {
+	return valueAt(valueAt(s.marks, row-1), col)
+}
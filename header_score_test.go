@@ -0,0 +1,127 @@
+package excelinspect
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScoredHeaderRow(t *testing.T) {
+	// None of these headers are in the built-in profile, so every sheet
+	// falls through to scoring.
+	tests := []struct {
+		name           string
+		rows           string
+		wantRow        int
+		wantConfidence float64
+	}{
+		{
+			// The one-cell banner scores zero and the blank row below it does
+			// not split the table.
+			name: "title banner",
+			rows: xrow(1, 0, "Quarterly Report") +
+				xrow(3, 0, "Region", "Units", "Revenue") +
+				xrow(4, 0, "North", "10", "100.5") +
+				xrow(5, 0, "South", "20", "200.5"),
+			wantRow:        3,
+			wantConfidence: 0.833,
+		},
+		{
+			// Without styling the first dense row wins on its bonus, even
+			// though the row below it contrasts better with the data.
+			name: "unstyled",
+			rows: xrow(1, 0, "Acme Corp", "Internal", "Draft") +
+				xrow(2, 0, "Widget", "Gizmo", "Sprocket") +
+				xrow(3, 0, "Bolt", "10", "1.5") +
+				xrow(4, 0, "Nut", "20", "0.5"),
+			wantRow:        1,
+			wantConfidence: 0.789,
+		},
+		{
+			name: "bold",
+			rows: xrow(1, 0, "Acme Corp", "Internal", "Draft") +
+				xrow(2, 1, "Widget", "Gizmo", "Sprocket") +
+				xrow(3, 0, "Bolt", "10", "1.5") +
+				xrow(4, 0, "Nut", "20", "0.5"),
+			wantRow:        2,
+			wantConfidence: 0.833,
+		},
+		{
+			name: "bottom border",
+			rows: xrow(1, 0, "Acme Corp", "Internal", "Draft") +
+				xrow(2, 3, "Widget", "Gizmo", "Sprocket") +
+				xrow(3, 0, "Bolt", "10", "1.5") +
+				xrow(4, 0, "Nut", "20", "0.5"),
+			wantRow:        2,
+			wantConfidence: 0.833,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ins := openTestWorkbook(t, xlsxFile(t, []testSheet{{name: "Data", rows: tt.rows}}, "", nil))
+			detail, err := ins.inspectSheetDetail(context.Background(), "Data")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(detail.Sections) != 1 {
+				t.Fatalf("sections = %d, want 1", len(detail.Sections))
+			}
+			sec := detail.Sections[0]
+			if sec.HeaderRow != tt.wantRow || sec.HeaderConfidence != tt.wantConfidence {
+				t.Errorf("header row %d with confidence %v, want %d with %v",
+					sec.HeaderRow, sec.HeaderConfidence, tt.wantRow, tt.wantConfidence)
+			}
+		})
+	}
+}
+
+func TestBestHeaderRow(t *testing.T) {
+	tests := []struct {
+		name      string
+		rows      [][]string
+		styled    cellStyleProbe
+		wantIdx   int
+		wantScore float64
+	}{
+		{
+			name:      "header over numbers",
+			rows:      [][]string{{"Name", "Qty"}, {"a", "1"}, {"b", "2"}},
+			wantIdx:   0,
+			wantScore: 0.889,
+		},
+		{
+			// The same header scores lower over text, since only data
+			// below a label counts as contrast.
+			name:      "header over text",
+			rows:      [][]string{{"Name", "Qty"}, {"a", "x"}, {"b", "y"}},
+			wantIdx:   0,
+			wantScore: 0.778,
+		},
+		{
+			name: "styled second row",
+			rows: [][]string{{"Acme Corp", "Internal", "Draft"}, {"Widget", "Gizmo", "Sprocket"}, {"Bolt", "10", "1.5"}},
+			styled: func(row, col int) bool {
+				return row == 2
+			},
+			wantIdx:   1,
+			wantScore: 0.833,
+		},
+		{
+			name:    "single column",
+			rows:    [][]string{{"Name"}, {"a"}, {"b"}},
+			wantIdx: -1,
+		},
+		{
+			name:    "no rows below",
+			rows:    [][]string{{"Name", "Qty"}},
+			wantIdx: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, score := bestHeaderRow(tt.rows, tableBlock{start: 0, end: len(tt.rows)}, tt.styled)
+			if idx != tt.wantIdx || score != tt.wantScore {
+				t.Errorf("bestHeaderRow = %d, %v, want %d, %v", idx, score, tt.wantIdx, tt.wantScore)
+			}
+		})
+	}
+}
@@ -1,25 +1,89 @@
 package excelinspect
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"strings"
-
-	toon "github.com/mateuszkardas/toon-go"
-	"github.com/thedatashed/xlsxreader"
-	"github.com/xuri/excelize/v2"
+	"sync"
+	"time"
 )
 
 type Inspector struct {
 	filePath         string
-	file             *excelize.File
-	xl               *xlsxreader.XlsxFileCloser
+	wb               *workbook
+	closer           io.Closer
+	sheetMu          sync.Mutex
+	sheetCache       map[string]*sheetData
+	config           inspectorConfig
+	detector         *detector
+	progressMu       sync.Mutex
 	progressCallback func(ProgressInfo)
 	progressChan     chan<- ProgressInfo
 }
 
 type InspectorOption func(*Inspector)
 
+// inspectorConfig holds the tunables set through InspectorOption values.
+type inspectorConfig struct {
+	maxSampleRows    int
+	maxSamples       int
+	headerRow        int
+	includeRowCount  bool
+	timeout          time.Duration
+	profile          bool
+	profileTopValues int
+	typedValues      bool
+	mergeFill        MergeFill
+	concurrency      int
+	delimiter        rune
+	password         string
+	hiddenSheets     bool
+	sheetInclude     []string
+	sheetExclude     []string
+}
+
+const (
+	defaultMaxSampleRows = 1000
+	defaultMaxSamples    = 5
+)
+
+func defaultInspectorConfig() inspectorConfig {
+	return inspectorConfig{
+		maxSampleRows:    defaultMaxSampleRows,
+		maxSamples:       defaultMaxSamples,
+		includeRowCount:  true,
+		profileTopValues: defaultProfileTopValues,
+		concurrency:      1,
+	}
+}
+
+// errInspectTimeout is the context cause used for the WithTimeout deadline,
+// so it can be told apart from a deadline set by the caller.
+var errInspectTimeout = errors.New("excelinspect: inspection timeout")
+
+// TimeoutError is returned when an inspection runs longer than the limit set
+// with WithTimeout. It unwraps to context.DeadlineExceeded.
+type TimeoutError struct {
+	Timeout time.Duration
+	Sheet   string
+	Row     int
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Sheet == "" {
+		return fmt.Sprintf("inspection timed out after %s", e.Timeout)
+	}
+	return fmt.Sprintf("inspection timed out after %s (sheet %q, row %d)", e.Timeout, e.Sheet, e.Row)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
 type ProgressInfo struct {
 	Phase   string  `json:"phase"`
 	Sheet   string  `json:"sheet,omitempty"`
@@ -28,20 +92,64 @@ type ProgressInfo struct {
 	Percent float64 `json:"percent"`
 }
 
+// WithTimeout aborts an inspection that takes longer than the given number of
+// seconds with a *TimeoutError. Zero or a negative value means no limit.
 func WithTimeout(seconds int) InspectorOption {
-	return func(i *Inspector) {}
+	return func(i *Inspector) {
+		i.config.timeout = time.Duration(max(0, seconds)) * time.Second
+	}
 }
 
+// WithHeaderRow forces the 1-based row used as the header of every sheet,
+// bypassing header and section detection; the header is that single row,
+// never grown into a stacked band.
 func WithHeaderRow(row int) InspectorOption {
-	return func(i *Inspector) {}
+	return func(i *Inspector) {
+		i.config.headerRow = max(0, row)
+	}
 }
 
+// WithMaxSampleRows limits how many worksheet rows are scanned per sheet for
+// headers, sections, columns and sample values (default 1000).
 func WithMaxSampleRows(rows int) InspectorOption {
-	return func(i *Inspector) {}
+	return func(i *Inspector) {
+		if rows > 0 {
+			i.config.maxSampleRows = rows
+		}
+	}
+}
+
+// WithMaxSamples sets how many sample values are kept per column (default 5).
+func WithMaxSamples(n int) InspectorOption {
+	return func(i *Inspector) {
+		if n > 0 {
+			i.config.maxSamples = n
+		}
+	}
 }
 
+// WithIncludeRowCount controls whether SheetInfo.RowCount is computed. Turning
+// it off lets Inspect stop reading each sheet after its first row and leaves
+// RowCount at zero.
 func WithIncludeRowCount(include bool) InspectorOption {
-	return func(i *Inspector) {}
+	return func(i *Inspector) {
+		i.config.includeRowCount = include
+	}
+}
+
+// WithSheetFilter limits inspection to sheets whose names match the given
+// glob patterns (path.Match syntax). Patterns starting with "!" exclude
+// matching sheets instead. With only exclusions, every other sheet is kept.
+func WithSheetFilter(patterns ...string) InspectorOption {
+	return func(i *Inspector) {
+		for _, p := range patterns {
+			if rest, ok := strings.CutPrefix(p, "!"); ok {
+				i.config.sheetExclude = append(i.config.sheetExclude, rest)
+				continue
+			}
+			i.config.sheetInclude = append(i.config.sheetInclude, p)
+		}
+	}
 }
 
 func WithProgressCallback(fn func(ProgressInfo)) InspectorOption {
@@ -56,200 +164,426 @@ func WithProgressChannel(ch chan<- ProgressInfo) InspectorOption {
 	}
 }
 
+// SheetInfo summarises one inspected sheet. Visibility is one of the Sheet*
+// visibility constants; only WithHiddenSheets lets hidden ones through.
+// RowCount is the number of the sheet's last row, the same count as
+// SheetDetail.RowCount once the sheet has been read. Before that, Inspect
+// takes it from the row count an .xlsx or .xls sheet declares, without
+// reading its rows, which a stale declaration can make differ.
 type SheetInfo struct {
 	Name        string `json:"name"`
+	Visibility  string `json:"visibility"`
 	RowCount    int    `json:"row_count"`
 	ColumnCount int    `json:"column_count"`
+	ScannedRows int    `json:"scanned_rows,omitempty"`
+	Truncated   bool   `json:"truncated,omitempty"`
 }
 
+// ColumnInfo describes one column of a section. HeaderPath is set for columns
+// under a stacked header, listing the labels from the outermost merged parent
+// down to the column's own label; Name joins them with " - ".
+//
+// DataType is the most frequent non-empty type among all scanned values of
+// the column (one of the DataType constants), and TypeCounts is the full
+// histogram, including empty cells in rows that hold data. Profile is set when
+// WithColumnProfiling is on.
+//
+// FormulaCount is the number of scanned data cells computed by a formula.
+// Formula is the most common of those formulas in R1C1 notation, so a
+// formula filled down the column reads the same in every row; it is empty
+// for .xls files, whose formulas are stored compiled. CrossSheetRefs lists
+// the ranges on other sheets the formulas read, as "Sheet!A2:B40".
 type ColumnInfo struct {
-	Name          string        `json:"name"`
-	StartPosition string        `json:"start_position"`
-	SampleValues  []interface{} `json:"sample_values"`
-	DataType      string        `json:"data_type"`
+	Name           string         `json:"name"`
+	HeaderPath     []string       `json:"header_path,omitempty"`
+	StartPosition  string         `json:"start_position"`
+	SampleValues   []interface{}  `json:"sample_values"`
+	DataType       string         `json:"data_type"`
+	TypeCounts     map[string]int `json:"type_counts,omitempty"`
+	Profile        *ColumnProfile `json:"profile,omitempty"`
+	FormulaCount   int            `json:"formula_count,omitempty"`
+	Formula        string         `json:"formula,omitempty"`
+	CrossSheetRefs []string       `json:"cross_sheet_refs,omitempty"`
+
+	profiler *columnProfiler
 }
 
+// SheetDetail describes one sheet. RowCount is the sheet's real row count,
+// the number of its last row counted to the end of the sheet, while
+// headers, columns and sections only cover the first ScannedRows rows;
+// Truncated is set when the sheet has rows beyond that prefix.
+// HeaderConfidence is the confidence of the first section's header row, from
+// 0 (guessed) to 1 (matched the detection profile or forced).
+// HiddenRows and HiddenColumns list the rows and columns hidden anywhere in
+// the sheet, as "5" or "7:9" and "C" or "E:G"; they are still inspected.
+// MergedCells lists the sheet's merged ranges, as "A1:E1".
+// UnscannedTables lists the Excel tables that start past the scanned rows,
+// as "Name (B2000:D2100)"; they have no section.
 type SheetDetail struct {
-	Name        string       `json:"name"`
-	RowCount    int          `json:"row_count"`
-	ColumnCount int          `json:"column_count"`
-	Headers     []string     `json:"headers"`
-	Columns     []ColumnInfo `json:"columns"`
-	Sections    []Section    `json:"sections,omitempty"`
+	Name             string       `json:"name"`
+	Visibility       string       `json:"visibility"`
+	RowCount         int          `json:"row_count"`
+	ColumnCount      int          `json:"column_count"`
+	ScannedRows      int          `json:"scanned_rows"`
+	Truncated        bool         `json:"truncated"`
+	HeaderConfidence float64      `json:"header_confidence"`
+	Headers          []string     `json:"headers"`
+	Columns          []ColumnInfo `json:"columns"`
+	Sections         []Section    `json:"sections,omitempty"`
+	HiddenRows       []string     `json:"hidden_rows,omitempty"`
+	HiddenColumns    []string     `json:"hidden_columns,omitempty"`
+	MergedCells      []string     `json:"merged_cells,omitempty"`
+	UnscannedTables  []string     `json:"unscanned_tables,omitempty"`
 }
 
+// FileInfo is the result of an inspection. SkippedSheets lists the sheets of
+// the workbook that were not inspected, in workbook order. DefinedNames
+// lists the workbook's defined names, whichever sheets they belong to.
+// Dependencies is the formula dependency graph of the inspected sheets, set
+// by InspectWithDetails.
 type FileInfo struct {
-	Sheets       []SheetInfo   `json:"sheets"`
-	SheetDetails []SheetDetail `json:"sheet_details,omitempty"`
+	Sheets        []SheetInfo    `json:"sheets"`
+	SheetDetails  []SheetDetail  `json:"sheet_details,omitempty"`
+	SkippedSheets []SkippedSheet `json:"skipped_sheets,omitempty"`
+	DefinedNames  []DefinedName  `json:"defined_names,omitempty"`
+	Dependencies  []Dependency   `json:"dependencies,omitempty"`
 }
 
+// Section is one table-like region of a sheet. Sections taken from an Excel
+// table have Table set to the table's name and Range to its full range
+// (header and totals rows included); their EndRow is the table's last data
+// row, which may lie past the scanned prefix, and TotalsRow is its totals
+// row, if any. A table without a header row has HeaderRow 0 and columns
+// without a StartPosition. Other sections are detected and start at column A.
 type Section struct {
-	Title       string       `json:"title"`
-	HeaderRow   int          `json:"header_row"`
-	StartRow    int          `json:"start_row"`
-	EndRow      int          `json:"end_row"`
-	Headers     []string     `json:"headers"`
-	Columns     []ColumnInfo `json:"columns"`
-	Rows        []SectionRow `json:"rows,omitempty"`
-	RowCount    int          `json:"row_count"`
-	ColumnCount int          `json:"column_count"`
+	Title            string       `json:"title"`
+	Table            string       `json:"table,omitempty"`
+	Range            string       `json:"range,omitempty"`
+	HeaderRow        int          `json:"header_row"`
+	HeaderDepth      int          `json:"header_depth"`
+	HeaderConfidence float64      `json:"header_confidence"`
+	StartRow         int          `json:"start_row"`
+	EndRow           int          `json:"end_row"`
+	TotalsRow        int          `json:"totals_row,omitempty"`
+	Headers          []string     `json:"headers"`
+	Columns          []ColumnInfo `json:"columns"`
+	Rows             []SectionRow `json:"rows,omitempty"`
+	RowCount         int          `json:"row_count"`
+	ColumnCount      int          `json:"column_count"`
 }
 
+// SectionRow is one data row of a section keyed by header. TypedValues holds
+// the same cells as native Go values and is only set with WithTypedValues.
 type SectionRow struct {
-	RowNumber int               `json:"row_number"`
-	Values    map[string]string `json:"values"`
+	RowNumber   int                    `json:"row_number"`
+	Values      map[string]string      `json:"values"`
+	TypedValues map[string]interface{} `json:"typed_values,omitempty"`
 }
 
+// New opens the workbook at filePath. The file is kept open until Close.
 func New(filePath string, opts ...InspectorOption) (*Inspector, error) {
-	if _, err := os.Stat(filePath); err != nil {
+	f, err := os.Open(filePath)
+	if err != nil {
 		return nil, fmt.Errorf("file not found: %w", err)
 	}
-
-	f, err := excelize.OpenFile(filePath)
+	st, err := f.Stat()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open excel file: %w", err)
+		f.Close()
+		return nil, fmt.Errorf("file not found: %w", err)
 	}
 
-	xl, err := xlsxreader.OpenFile(filePath)
+	ins, err := newInspector(f, st.Size(), filePath, f, opts)
 	if err != nil {
 		f.Close()
-		return nil, fmt.Errorf("failed to open excel file: %w", err)
-	}
-
-	ins := &Inspector{
-		filePath: filePath,
-		file:     f,
-		xl:       xl,
+		return nil, err
 	}
-
-	for _, opt := range opts {
-		opt(ins)
-	}
-
 	return ins, nil
 }
 
 func (i *Inspector) Close() error {
-	if i.file != nil {
-		i.file.Close()
-	}
-	if i.xl != nil {
-		i.xl.Close()
+	if i.closer != nil {
+		return i.closer.Close()
 	}
 	return nil
 }
 
 func (i *Inspector) Inspect() (*FileInfo, error) {
-	sheets := i.file.GetSheetList()
-	visibleSheets := i.visibleSheets(sheets)
+	return i.InspectContext(context.Background())
+}
 
-	info := &FileInfo{
-		Sheets: make([]SheetInfo, 0, len(sheets)),
-	}
+// InspectContext is like Inspect but stops when ctx is done, returning the
+// context error wrapped with the sheet and row the scan had reached.
+func (i *Inspector) InspectContext(ctx context.Context) (*FileInfo, error) {
+	ctx, cancel := i.timeoutContext(ctx)
+	defer cancel()
+	return i.inspect(ctx)
+}
 
-	total := len(visibleSheets)
-	i.emitProgress("inspect_sheets", "", 0, total)
-	for idx, sheetName := range visibleSheets {
-		rowCount := i.getRowCount(sheetName)
-		colCount := i.getColumnCount(sheetName)
+func (i *Inspector) InspectWithDetails() (*FileInfo, error) {
+	return i.InspectWithDetailsContext(context.Background())
+}
 
-		info.Sheets = append(info.Sheets, SheetInfo{
-			Name:        sheetName,
-			RowCount:    rowCount,
-			ColumnCount: colCount,
-		})
-		i.emitProgress("inspect_sheets", sheetName, idx+1, total)
+// InspectWithDetailsContext is like InspectWithDetails but stops when ctx is
+// done, returning the context error wrapped with the sheet and row reached.
+func (i *Inspector) InspectWithDetailsContext(ctx context.Context) (*FileInfo, error) {
+	ctx, cancel := i.timeoutContext(ctx)
+	defer cancel()
+	return i.inspectWithDetails(ctx)
+}
+
+// timeoutContext derives the context an inspection runs under, applying the
+// WithTimeout limit when one is configured.
+func (i *Inspector) timeoutContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if i.config.timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeoutCause(ctx, i.config.timeout, errInspectTimeout)
+}
 
-	return info, nil
+// scanError converts a done context into the error reported to the caller.
+func (i *Inspector) scanError(ctx context.Context, sheet string, row int) error {
+	if context.Cause(ctx) == errInspectTimeout {
+		return &TimeoutError{Timeout: i.config.timeout, Sheet: sheet, Row: row}
+	}
+	return fmt.Errorf("inspection of sheet %q stopped at row %d: %w", sheet, row, ctx.Err())
 }
 
-func (i *Inspector) InspectWithDetails() (*FileInfo, error) {
-	sheets := i.file.GetSheetList()
-	visibleSheets := i.visibleSheets(sheets)
+func (i *Inspector) inspect(ctx context.Context) (*FileInfo, error) {
+	sheets, skipped := i.selectSheets(i.wb.sheetNames())
 
 	info := &FileInfo{
-		Sheets:       make([]SheetInfo, 0, len(sheets)),
-		SheetDetails: make([]SheetDetail, 0, len(sheets)),
+		Sheets:        make([]SheetInfo, len(sheets)),
+		SkippedSheets: skipped,
+	}
+	err := i.forEachSheet(ctx, "inspect_sheets", sheets, func(ctx context.Context, idx int, sheetName string) error {
+		sheet, err := i.inspectSheet(ctx, sheetName)
+		if err != nil {
+			return err
+		}
+		info.Sheets[idx] = sheet
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	if info.DefinedNames, err = i.definedNames(ctx, false); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
 
-	total := len(visibleSheets)
-	i.emitProgress("inspect_details", "", 0, total)
-	for idx, sheetName := range visibleSheets {
-		rowCount := i.getRowCount(sheetName)
-		colCount := i.getColumnCount(sheetName)
+func (i *Inspector) inspectSheet(ctx context.Context, sheetName string) (SheetInfo, error) {
+	sheet := SheetInfo{Name: sheetName, Visibility: i.sheetVisibility(sheetName)}
+	rowCount, colCount, err := i.sheetHead(ctx, sheetName, i.config.includeRowCount)
+	if err != nil {
+		return sheet, err
+	}
+	if i.config.includeRowCount {
+		sheet.RowCount = rowCount
+	}
+	sheet.ColumnCount = colCount
+	return sheet, nil
+}
 
-		info.Sheets = append(info.Sheets, SheetInfo{
-			Name:        sheetName,
-			RowCount:    rowCount,
-			ColumnCount: colCount,
-		})
+func (i *Inspector) inspectWithDetails(ctx context.Context) (*FileInfo, error) {
+	sheets, skipped := i.selectSheets(i.wb.sheetNames())
 
-		detail := i.inspectSheetDetail(sheetName)
-		info.SheetDetails = append(info.SheetDetails, detail)
-		i.emitProgress("inspect_details", sheetName, idx+1, total)
+	info := &FileInfo{
+		Sheets:        make([]SheetInfo, len(sheets)),
+		SheetDetails:  make([]SheetDetail, len(sheets)),
+		SkippedSheets: skipped,
+	}
+	deps := make([][]Dependency, len(sheets))
+	err := i.forEachSheet(ctx, "inspect_details", sheets, func(ctx context.Context, idx int, sheetName string) error {
+		detail, err := i.inspectSheetDetail(ctx, sheetName)
+		if err != nil {
+			return err
+		}
+		// inspectSheetDetail has read the sheet, so this is a cache hit.
+		data, err := i.sheetData(ctx, sheetName)
+		if err != nil {
+			return err
+		}
+		sheet := SheetInfo{
+			Name:        sheetName,
+			Visibility:  detail.Visibility,
+			ColumnCount: data.firstWidth,
+			ScannedRows: detail.ScannedRows,
+			Truncated:   detail.Truncated,
+		}
+		if i.config.includeRowCount {
+			sheet.RowCount = detail.RowCount
+		}
+		info.Sheets[idx] = sheet
+		info.SheetDetails[idx] = detail
+		deps[idx] = formulaDependencies(sheetName, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deps {
+		info.Dependencies = append(info.Dependencies, d...)
+	}
+	if info.DefinedNames, err = i.definedNames(ctx, true); err != nil {
+		return nil, err
 	}
-
 	return info, nil
 }
 
 func (i *Inspector) InspectTOON() (string, error) {
-	info, err := i.Inspect()
+	return i.InspectTOONContext(context.Background())
+}
+
+func (i *Inspector) InspectTOONContext(ctx context.Context) (string, error) {
+	ctx, cancel := i.timeoutContext(ctx)
+	defer cancel()
+	info, err := i.inspect(ctx)
 	if err != nil {
 		return "", err
 	}
-	return toon.Marshal(info, nil)
+	var b strings.Builder
+	if err := i.writeTOON(ctx, &b, info, RenderOptions{}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
 }
 
 func (i *Inspector) InspectWithDetailsTOON() (string, error) {
-	info, err := i.InspectWithDetails()
+	return i.InspectWithDetailsTOONContext(context.Background())
+}
+
+func (i *Inspector) InspectWithDetailsTOONContext(ctx context.Context) (string, error) {
+	ctx, cancel := i.timeoutContext(ctx)
+	defer cancel()
+	info, err := i.inspectWithDetails(ctx)
 	if err != nil {
 		return "", err
 	}
-	return toon.Marshal(i.buildCompactTOONPayloadFull(info), nil)
+	var b strings.Builder
+	if err := i.writeTOON(ctx, &b, info, RenderOptions{Detailed: true}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
 }
 
 func (i *Inspector) InspectWithDetailsTOONSample() (string, error) {
-	info, err := i.InspectWithDetails()
+	return i.InspectWithDetailsTOONSampleContext(context.Background())
+}
+
+func (i *Inspector) InspectWithDetailsTOONSampleContext(ctx context.Context) (string, error) {
+	ctx, cancel := i.timeoutContext(ctx)
+	defer cancel()
+	info, err := i.inspectWithDetails(ctx)
 	if err != nil {
 		return "", err
 	}
-	return toon.Marshal(buildCompactTOONPayloadSample(info), nil)
+	var b strings.Builder
+	if err := i.writeTOON(ctx, &b, info, RenderOptions{Detailed: true, Sample: true}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
 }
 
 func (i *Inspector) InspectMarkdown() (string, error) {
-	info, err := i.Inspect()
+	return i.InspectMarkdownContext(context.Background())
+}
+
+func (i *Inspector) InspectMarkdownContext(ctx context.Context) (string, error) {
+	ctx, cancel := i.timeoutContext(ctx)
+	defer cancel()
+	info, err := i.inspect(ctx)
 	if err != nil {
 		return "", err
 	}
-	return i.MarkdownFromInfo(info, false), nil
+	var b strings.Builder
+	if err := i.writeMarkdown(ctx, &b, info, false); err != nil {
+		return "", err
+	}
+	return b.String(), nil
 }
 
 func (i *Inspector) InspectWithDetailsMarkdown() (string, error) {
-	info, err := i.InspectWithDetails()
+	return i.InspectWithDetailsMarkdownContext(context.Background())
+}
+
+func (i *Inspector) InspectWithDetailsMarkdownContext(ctx context.Context) (string, error) {
+	ctx, cancel := i.timeoutContext(ctx)
+	defer cancel()
+	info, err := i.inspectWithDetails(ctx)
 	if err != nil {
 		return "", err
 	}
-	return i.MarkdownFromInfo(info, true), nil
+	var b strings.Builder
+	if err := i.writeMarkdown(ctx, &b, info, true); err != nil {
+		return "", err
+	}
+	return b.String(), nil
 }
 
-func (i *Inspector) MarkdownFromInfo(info *FileInfo, detailed bool) string {
-	return i.buildMarkdown(info, detailed)
+// MarkdownFromInfo renders an earlier inspection result as Markdown. Section
+// tables are built from the sheets' cached rows; a sheet no longer cached is
+// read again, and an error reading it is returned.
+func (i *Inspector) MarkdownFromInfo(info *FileInfo, detailed bool) (string, error) {
+	var b strings.Builder
+	if err := i.writeMarkdown(context.Background(), &b, info, detailed); err != nil {
+		return "", err
+	}
+	return b.String(), nil
 }
 
-func (i *Inspector) buildMarkdown(info *FileInfo, detailed bool) string {
-	var b strings.Builder
+// writeMarkdown renders info as Markdown to w. Output is flushed after every
+// sheet and section, so memory use does not grow with the report.
+func (i *Inspector) writeMarkdown(ctx context.Context, w io.Writer, info *FileInfo, detailed bool) error {
+	b := newRenderWriter(w)
 
 	b.WriteString("# Excel Inspect Report\n\n")
 	b.WriteString("## Sheets\n\n")
-	b.WriteString("| Name | Rows | Columns |\n")
-	b.WriteString("| --- | ---: | ---: |\n")
+	// The visibility column only appears once WithHiddenSheets lets a
+	// hidden sheet through.
+	showVisibility := false
 	for _, s := range info.Sheets {
-		b.WriteString(fmt.Sprintf("| %s | %d | %d |\n", escapeMarkdownCell(s.Name), s.RowCount, s.ColumnCount))
+		showVisibility = showVisibility || (s.Visibility != "" && s.Visibility != SheetVisible)
+	}
+	if showVisibility {
+		b.WriteString("| Name | Visibility | Rows | Columns |\n")
+		b.WriteString("| --- | --- | ---: | ---: |\n")
+	} else {
+		b.WriteString("| Name | Rows | Columns |\n")
+		b.WriteString("| --- | ---: | ---: |\n")
+	}
+	for _, s := range info.Sheets {
+		if showVisibility {
+			b.WriteString(fmt.Sprintf("| %s | %s | %d | %d |\n", escapeMarkdownCell(s.Name), s.Visibility, s.RowCount, s.ColumnCount))
+		} else {
+			b.WriteString(fmt.Sprintf("| %s | %d | %d |\n", escapeMarkdownCell(s.Name), s.RowCount, s.ColumnCount))
+		}
+	}
+	if len(info.SkippedSheets) > 0 {
+		b.WriteString("\n## Skipped Sheets\n\n")
+		b.WriteString("| Name | Visibility | Reason |\n")
+		b.WriteString("| --- | --- | --- |\n")
+		for _, s := range info.SkippedSheets {
+			b.WriteString(fmt.Sprintf("| %s | %s | %s |\n", escapeMarkdownCell(s.Name), s.Visibility, s.Reason))
+		}
+	}
+	if len(info.DefinedNames) > 0 {
+		b.WriteString("\n## Defined Names\n\n")
+		b.WriteString("| Name | Scope | Refers to | Range | Samples |\n")
+		b.WriteString("| --- | --- | --- | --- | --- |\n")
+		for _, n := range info.DefinedNames {
+			b.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n",
+				escapeMarkdownCell(n.Name),
+				escapeMarkdownCell(n.Scope),
+				escapeMarkdownCell(n.RefersTo),
+				escapeMarkdownCell(n.Range),
+				escapeMarkdownCell(strings.Join(n.SampleValues, ", ")),
+			))
+		}
 	}
 
 	if !detailed || len(info.SheetDetails) == 0 {
-		return b.String()
+		return b.flush()
 	}
 
 	totalSections := 0
@@ -264,9 +598,28 @@ func (i *Inspector) buildMarkdown(info *FileInfo, detailed bool) string {
 	b.WriteString("\n## Sheet Details\n")
 	for _, d := range info.SheetDetails {
 		b.WriteString(fmt.Sprintf("\n### %s\n\n", escapeMarkdownCell(d.Name)))
+		if d.Visibility != "" && d.Visibility != SheetVisible {
+			b.WriteString(fmt.Sprintf("- Visibility: %s\n", d.Visibility))
+		}
 		b.WriteString(fmt.Sprintf("- Rows: %d\n", d.RowCount))
+		if d.Truncated {
+			b.WriteString(fmt.Sprintf("- Scanned rows: %d (truncated; headers, columns and sections cover this prefix only)\n", d.ScannedRows))
+		}
 		b.WriteString(fmt.Sprintf("- Columns: %d\n", d.ColumnCount))
 		b.WriteString(fmt.Sprintf("- Headers: %d\n", len(d.Headers)))
+		b.WriteString(fmt.Sprintf("- Header confidence: %.2f\n", d.HeaderConfidence))
+		if len(d.HiddenRows) > 0 {
+			b.WriteString(fmt.Sprintf("- Hidden rows: %s\n", joinLabels(d.HiddenRows)))
+		}
+		if len(d.HiddenColumns) > 0 {
+			b.WriteString(fmt.Sprintf("- Hidden columns: %s\n", joinLabels(d.HiddenColumns)))
+		}
+		if len(d.MergedCells) > 0 {
+			b.WriteString(fmt.Sprintf("- Merged cells: %s\n", joinLabels(d.MergedCells)))
+		}
+		if len(d.UnscannedTables) > 0 {
+			b.WriteString(fmt.Sprintf("- Unscanned tables: %s\n", joinLabels(d.UnscannedTables)))
+		}
 
 		if len(d.Columns) > 0 {
 			b.WriteString("\n#### Columns\n\n")
@@ -279,10 +632,12 @@ func (i *Inspector) buildMarkdown(info *FileInfo, detailed bool) string {
 					idx+1,
 					escapeMarkdownCell(c.Name),
 					escapeMarkdownCell(c.StartPosition),
-					escapeMarkdownCell(c.DataType),
+					escapeMarkdownCell(columnTypeLabel(c)),
 					escapeMarkdownCell(strings.Join(samples, ", ")),
 				))
 			}
+			writeMarkdownProfiles(b, d.Columns)
+			writeMarkdownFormulas(b, d.Columns)
 		}
 
 		if len(d.Sections) > 0 {
@@ -292,14 +647,32 @@ func (i *Inspector) buildMarkdown(info *FileInfo, detailed bool) string {
 					maxEndRow = s.EndRow
 				}
 			}
-			rowsByNum := i.sheetRowsByNumber(d.Name, maxEndRow)
+			rows, err := i.sheetRows(ctx, d.Name, maxEndRow)
+			if err != nil {
+				return err
+			}
+			filler, err := i.mergeFiller(ctx, d.Name)
+			if err != nil {
+				return err
+			}
 
 			b.WriteString("\n#### Sections\n\n")
 			for idx, s := range d.Sections {
 				b.WriteString(fmt.Sprintf("##### Section %d: %s\n\n", idx+1, escapeMarkdownCell(s.Title)))
-				b.WriteString(fmt.Sprintf("- Header row: %d\n", s.HeaderRow))
+				if s.Table != "" {
+					b.WriteString(fmt.Sprintf("- Table: %s (%s)\n", escapeMarkdownCell(s.Table), s.Range))
+				}
+				if s.HeaderDepth > 1 {
+					b.WriteString(fmt.Sprintf("- Header rows: %d-%d\n", s.HeaderRow-s.HeaderDepth+1, s.HeaderRow))
+				} else {
+					b.WriteString(fmt.Sprintf("- Header row: %d\n", s.HeaderRow))
+				}
+				b.WriteString(fmt.Sprintf("- Header confidence: %.2f\n", s.HeaderConfidence))
 				b.WriteString(fmt.Sprintf("- Start row: %d\n", s.StartRow))
 				b.WriteString(fmt.Sprintf("- End row: %d\n", s.EndRow))
+				if s.TotalsRow > 0 {
+					b.WriteString(fmt.Sprintf("- Totals row: %d\n", s.TotalsRow))
+				}
 				b.WriteString(fmt.Sprintf("- Rows: %d\n", s.RowCount))
 				b.WriteString(fmt.Sprintf("- Columns: %d\n", s.ColumnCount))
 				b.WriteString("\n")
@@ -312,9 +685,12 @@ func (i *Inspector) buildMarkdown(info *FileInfo, detailed bool) string {
 					}
 				}
 
-				values := sectionValuesFromRows(rowsByNum, s, len(headers))
+				values := sectionValuesFromRows(rows, s, len(headers), filler)
 				if len(values) == 0 {
 					b.WriteString("_No section rows found._\n\n")
+					if err := b.flush(); err != nil {
+						return err
+					}
 					doneSections++
 					i.emitProgress("markdown_sections", d.Name, doneSections, totalSections)
 					continue
@@ -349,24 +725,42 @@ func (i *Inspector) buildMarkdown(info *FileInfo, detailed bool) string {
 					b.WriteString(" |\n")
 				}
 				b.WriteString("\n")
+				if err := b.flush(); err != nil {
+					return err
+				}
 				doneSections++
 				i.emitProgress("markdown_sections", d.Name, doneSections, totalSections)
 			}
 		}
+		if err := b.flush(); err != nil {
+			return err
+		}
 	}
 
-	return b.String()
+	if len(info.Dependencies) > 0 {
+		b.WriteString("\n## Formula Dependencies\n\n")
+		b.WriteString("| From | To | Cells |\n")
+		b.WriteString("| --- | --- | ---: |\n")
+		for _, dep := range info.Dependencies {
+			b.WriteString(fmt.Sprintf("| %s | %s | %d |\n",
+				escapeMarkdownCell(quoteSheetName(dep.FromSheet)+"!"+dep.From),
+				escapeMarkdownCell(quoteSheetName(dep.ToSheet)+"!"+dep.To),
+				dep.Cells))
+		}
+	}
+	return b.flush()
 }
 
-func sectionValuesFromRows(rowsByNum map[int][]string, section Section, width int) [][]string {
+func sectionValuesFromRows(rows [][]string, section Section, width int, filler *mergeFiller) [][]string {
 	if width <= 0 || section.StartRow <= 0 || section.EndRow < section.StartRow {
 		return nil
 	}
 
-	out := make([][]string, 0, max(0, section.EndRow-section.StartRow+1))
-	for rowNum := section.StartRow; rowNum <= section.EndRow; rowNum++ {
-		row, ok := rowsByNum[rowNum]
-		if !ok {
+	out := make([][]string, 0, max(0, min(section.EndRow, len(rows))-section.StartRow+1))
+	left := section.firstColumn()
+	for rowNum := section.StartRow; rowNum <= section.EndRow && rowNum <= len(rows); rowNum++ {
+		row := from(filler.fill(rowNum, rows[rowNum-1]), left)
+		if row == nil {
 			continue
 		}
 		values := make([]string, width)
@@ -383,28 +777,95 @@ func sectionValuesFromRows(rowsByNum map[int][]string, section Section, width in
 	return out
 }
 
-func (i *Inspector) sheetRowsByNumber(sheet string, maxRow int) map[int][]string {
+// sheetRows returns the scanned rows of a sheet up to the 1-based maxRow,
+// indexed as rows[n-1] for worksheet row n.
+func (i *Inspector) sheetRows(ctx context.Context, sheet string, maxRow int) ([][]string, error) {
 	if maxRow <= 0 {
-		return nil
+		return nil, nil
 	}
-	rows := i.xl.ReadRows(sheet)
-	out := make(map[int][]string, maxRow)
-	rowNum := 0
-	for row := range rows {
-		rowNum++
-		if rowNum > maxRow {
-			break
+	data, err := i.sheetData(ctx, sheet)
+	if err != nil {
+		return nil, err
+	}
+	return data.rows[:min(maxRow, len(data.rows))], nil
+}
+
+// writeMarkdownProfiles writes the profile table of columns, if profiling
+// was enabled.
+func writeMarkdownProfiles(b *renderWriter, columns []ColumnInfo) {
+	profiled := false
+	for _, c := range columns {
+		profiled = profiled || c.Profile != nil
+	}
+	if !profiled {
+		return
+	}
+	b.WriteString("\n#### Column Profiles\n\n")
+	b.WriteString("| # | Name | Nulls | Blanks | Distinct | Min | Max | Mean | Std dev | P25 / P50 / P75 / P95 | Length (min / avg / max) | Top values |\n")
+	b.WriteString("| ---: | --- | ---: | ---: | ---: | --- | --- | --- | --- | --- | --- | --- |\n")
+	for idx, c := range columns {
+		p := c.Profile
+		if p == nil {
+			continue
 		}
-		values := make([]string, len(row.Cells))
-		for idx, cell := range row.Cells {
-			values[idx] = strings.TrimSpace(cell.Value)
+		stats := profileStats(p, c.DataType)
+		percentiles := ""
+		if stats[4] != "" {
+			percentiles = strings.Join(stats[4:], " / ")
 		}
-		out[rowNum] = values
-		if rowNum%100 == 0 || rowNum == maxRow {
-			i.emitProgress("markdown_scan_rows", sheet, rowNum, maxRow)
+		b.WriteString(fmt.Sprintf(
+			"| %d | %s | %d | %d | %s | %s | %s | %s | %s | %s | %d / %.1f / %d | %s |\n",
+			idx+1,
+			escapeMarkdownCell(c.Name),
+			p.NullCount,
+			p.BlankCount,
+			distinctLabel(p),
+			escapeMarkdownCell(stats[0]),
+			escapeMarkdownCell(stats[1]),
+			escapeMarkdownCell(stats[2]),
+			escapeMarkdownCell(stats[3]),
+			escapeMarkdownCell(percentiles),
+			p.Length.Min, p.Length.Avg, p.Length.Max,
+			escapeMarkdownCell(formatTopValues(p.TopValues, ", ")),
+		))
+	}
+}
+
+// writeMarkdownFormulas writes the formula table of columns, if any column
+// holds formulas.
+func writeMarkdownFormulas(b *renderWriter, columns []ColumnInfo) {
+	computed := false
+	for _, c := range columns {
+		computed = computed || c.FormulaCount > 0
+	}
+	if !computed {
+		return
+	}
+	b.WriteString("\n#### Formulas\n\n")
+	b.WriteString("| # | Name | Formula cells | Formula (R1C1) | Cross-sheet references |\n")
+	b.WriteString("| ---: | --- | ---: | --- | --- |\n")
+	for idx, c := range columns {
+		if c.FormulaCount == 0 {
+			continue
 		}
+		b.WriteString(fmt.Sprintf(
+			"| %d | %s | %d | %s | %s |\n",
+			idx+1,
+			escapeMarkdownCell(c.Name),
+			c.FormulaCount,
+			escapeMarkdownCell(c.Formula),
+			escapeMarkdownCell(strings.Join(c.CrossSheetRefs, ", ")),
+		))
 	}
-	return out
+}
+
+// columnTypeLabel renders a column's type for Markdown, appending the type
+// histogram when the column mixes several types.
+func columnTypeLabel(c ColumnInfo) string {
+	if !columnTypeStats(c.TypeCounts).mixed() {
+		return c.DataType
+	}
+	return fmt.Sprintf("%s (%s)", c.DataType, formatTypeCounts(c.TypeCounts, ", "))
 }
 
 func escapeMarkdownCell(v string) string {
@@ -418,7 +879,31 @@ func escapeMarkdownCell(v string) string {
 	return v
 }
 
-func buildCompactTOONPayloadSample(info *FileInfo) map[string]interface{} {
+// compactCol is one row of the TOON columns table: a column of a sheet,
+// merged across the sections that share its position and name. left is the
+// 0-based sheet column of its section's first column; the columns of an
+// Excel table also keep the table's data rows, startRow to endRow.
+type compactCol struct {
+	sheet     string
+	left      int
+	startRow  int
+	endRow    int
+	columnIdx int
+	name      string
+	startPos  string
+	dataType  string
+	types     map[string]int
+	samples   []string
+}
+
+func buildCompactTOONPayloadSample(info *FileInfo, maxSamples int) map[string]interface{} {
+	payload, _ := buildCompactTOONPayload(info, maxSamples)
+	return payload
+}
+
+// buildCompactTOONPayload builds the sample TOON payload and returns the
+// columns of its columns table alongside, in the same order.
+func buildCompactTOONPayload(info *FileInfo, maxSamples int) (map[string]interface{}, []compactCol) {
 	payload := map[string]interface{}{
 		"sheet_details": nil,
 		"sections":      nil,
@@ -426,69 +911,77 @@ func buildCompactTOONPayloadSample(info *FileInfo) map[string]interface{} {
 	}
 
 	sheetMeta := make([]map[string]interface{}, 0, len(info.SheetDetails))
-	type compactCol struct {
-		sheet     string
-		columnIdx int
-		name      string
-		startPos  string
-		dataType  string
-		samples   []string
-	}
 	colIndex := make(map[string]int)
 	compactCols := make([]compactCol, 0)
 	sections := make([]map[string]interface{}, 0)
 
 	for _, sd := range info.SheetDetails {
 		sheetMeta = append(sheetMeta, map[string]interface{}{
-			"name":          sd.Name,
-			"row_count":     sd.RowCount,
-			"column_count":  sd.ColumnCount,
-			"header_count":  len(sd.Headers),
-			"section_count": len(sd.Sections),
+			"name":             sd.Name,
+			"visibility":       sd.Visibility,
+			"hidden_rows":      strings.Join(sd.HiddenRows, "|"),
+			"hidden_columns":   strings.Join(sd.HiddenColumns, "|"),
+			"merged_cells":     strings.Join(sd.MergedCells, "|"),
+			"unscanned_tables": strings.Join(sd.UnscannedTables, "|"),
+			"row_count":        sd.RowCount,
+			"scanned_rows":     sd.ScannedRows,
+			"truncated":        sd.Truncated,
+			"column_count":     sd.ColumnCount,
+			"header_count":     len(sd.Headers),
+			"section_count":    len(sd.Sections),
 		})
 
 		if len(sd.Sections) > 0 {
 			for sIdx, sec := range sd.Sections {
 				sections = append(sections, map[string]interface{}{
-					"sheet":        sd.Name,
-					"section_idx":  sIdx + 1,
-					"title":        sec.Title,
-					"header_row":   sec.HeaderRow,
-					"start_row":    sec.StartRow,
-					"end_row":      sec.EndRow,
-					"row_count":    sec.RowCount,
-					"column_count": sec.ColumnCount,
+					"sheet":             sd.Name,
+					"section_idx":       sIdx + 1,
+					"title":             sec.Title,
+					"table":             sec.Table,
+					"range":             sec.Range,
+					"header_row":        sec.HeaderRow,
+					"header_confidence": sec.HeaderConfidence,
+					"start_row":         sec.StartRow,
+					"end_row":           sec.EndRow,
+					"totals_row":        sec.TotalsRow,
+					"row_count":         sec.RowCount,
+					"column_count":      sec.ColumnCount,
 				})
+				left := sec.firstColumn()
 				for cIdx, col := range sec.Columns {
-					key := fmt.Sprintf("%s|%d|%s", sd.Name, cIdx+1, col.Name)
+					key := fmt.Sprintf("%s|%d|%d|%s", sd.Name, left, cIdx+1, col.Name)
 					if pos, ok := colIndex[key]; ok {
-						compactCols[pos].samples = mergeSampleStrings(compactCols[pos].samples, toSampleStrings(col.SampleValues), 5)
-						if compactCols[pos].dataType == "" && col.DataType != "" {
-							compactCols[pos].dataType = col.DataType
-						}
+						compactCols[pos].samples = mergeSampleStrings(compactCols[pos].samples, toSampleStrings(col.SampleValues), maxSamples)
+						compactCols[pos].types = addTypeCounts(compactCols[pos].types, col.TypeCounts)
+						compactCols[pos].dataType = columnTypeStats(compactCols[pos].types).dominant()
 						continue
 					}
 					colIndex[key] = len(compactCols)
-					compactCols = append(compactCols, compactCol{
+					cc := compactCol{
 						sheet:     sd.Name,
+						left:      left,
 						columnIdx: cIdx + 1,
 						name:      col.Name,
 						startPos:  col.StartPosition,
 						dataType:  col.DataType,
+						types:     addTypeCounts(nil, col.TypeCounts),
 						samples:   toSampleStrings(col.SampleValues),
-					})
+					}
+					if sec.Table != "" {
+						cc.startRow, cc.endRow = sec.StartRow, sec.EndRow
+					}
+					compactCols = append(compactCols, cc)
 				}
 			}
 			continue
 		}
 
 		for cIdx, col := range sd.Columns {
-			key := fmt.Sprintf("%s|%d|%s", sd.Name, cIdx+1, col.Name)
+			key := fmt.Sprintf("%s|%d|%d|%s", sd.Name, 0, cIdx+1, col.Name)
 			if pos, ok := colIndex[key]; ok {
-				compactCols[pos].samples = mergeSampleStrings(compactCols[pos].samples, toSampleStrings(col.SampleValues), 5)
-				if compactCols[pos].dataType == "" && col.DataType != "" {
-					compactCols[pos].dataType = col.DataType
-				}
+				compactCols[pos].samples = mergeSampleStrings(compactCols[pos].samples, toSampleStrings(col.SampleValues), maxSamples)
+				compactCols[pos].types = addTypeCounts(compactCols[pos].types, col.TypeCounts)
+				compactCols[pos].dataType = columnTypeStats(compactCols[pos].types).dominant()
 				continue
 			}
 			colIndex[key] = len(compactCols)
@@ -498,6 +991,7 @@ func buildCompactTOONPayloadSample(info *FileInfo) map[string]interface{} {
 				name:      col.Name,
 				startPos:  col.StartPosition,
 				dataType:  col.DataType,
+				types:     addTypeCounts(nil, col.TypeCounts),
 				samples:   toSampleStrings(col.SampleValues),
 			})
 		}
@@ -511,6 +1005,7 @@ func buildCompactTOONPayloadSample(info *FileInfo) map[string]interface{} {
 			"name":           c.name,
 			"start_position": c.startPos,
 			"data_type":      c.dataType,
+			"type_counts":    formatTypeCounts(c.types, "|"),
 			"samples":        strings.Join(c.samples, "|"),
 		})
 	}
@@ -518,41 +1013,123 @@ func buildCompactTOONPayloadSample(info *FileInfo) map[string]interface{} {
 	payload["sheet_details"] = sheetMeta
 	payload["sections"] = sections
 	payload["columns"] = columns
-	return payload
+	if len(info.SkippedSheets) > 0 {
+		payload["skipped_sheets"] = info.SkippedSheets
+	}
+	if names := buildTOONDefinedNames(info); len(names) > 0 {
+		payload["defined_names"] = names
+	}
+	if profiles := buildTOONProfiles(info); len(profiles) > 0 {
+		payload["profiles"] = profiles
+	}
+	if formulas := buildTOONFormulas(info); len(formulas) > 0 {
+		payload["formulas"] = formulas
+	}
+	if len(info.Dependencies) > 0 {
+		payload["dependencies"] = info.Dependencies
+	}
+	return payload, compactCols
 }
 
-func (i *Inspector) buildCompactTOONPayloadFull(info *FileInfo) map[string]interface{} {
-	payload := buildCompactTOONPayloadSample(info)
-	colsRaw, ok := payload["columns"].([]map[string]interface{})
-	if !ok {
-		return payload
+// buildTOONProfiles flattens the column profiles of every sheet into TOON
+// rows. Statistics are strings so numeric and date columns share one table.
+func buildTOONProfiles(info *FileInfo) []map[string]interface{} {
+	profiles := make([]map[string]interface{}, 0)
+	for _, sd := range info.SheetDetails {
+		for cIdx, col := range sd.Columns {
+			p := col.Profile
+			if p == nil {
+				continue
+			}
+			stats := profileStats(p, col.DataType)
+			profiles = append(profiles, map[string]interface{}{
+				"sheet":          sd.Name,
+				"column_idx":     cIdx + 1,
+				"name":           col.Name,
+				"null_count":     p.NullCount,
+				"blank_count":    p.BlankCount,
+				"distinct_count": distinctLabel(p),
+				"min":            stats[0],
+				"max":            stats[1],
+				"mean":           stats[2],
+				"stddev":         stats[3],
+				"p25":            stats[4],
+				"p50":            stats[5],
+				"p75":            stats[6],
+				"p95":            stats[7],
+				"min_length":     p.Length.Min,
+				"avg_length":     p.Length.Avg,
+				"max_length":     p.Length.Max,
+				"top_values":     formatTopValues(p.TopValues, "|"),
+			})
+		}
+	}
+	return profiles
+}
+
+// buildTOONDefinedNames lists the workbook's defined names as TOON rows.
+func buildTOONDefinedNames(info *FileInfo) []map[string]interface{} {
+	names := make([]map[string]interface{}, 0, len(info.DefinedNames))
+	for _, n := range info.DefinedNames {
+		names = append(names, map[string]interface{}{
+			"name":      n.Name,
+			"scope":     n.Scope,
+			"refers_to": n.RefersTo,
+			"range":     n.Range,
+			"hidden":    n.Hidden,
+			"samples":   strings.Join(n.SampleValues, "|"),
+		})
 	}
+	return names
+}
 
-	cols := make([]map[string]interface{}, 0, len(colsRaw))
-	for _, c := range colsRaw {
-		cp := make(map[string]interface{}, len(c))
-		for k, v := range c {
-			cp[k] = v
+// buildTOONFormulas lists the computed columns of every sheet as TOON rows.
+func buildTOONFormulas(info *FileInfo) []map[string]interface{} {
+	formulas := make([]map[string]interface{}, 0)
+	for _, sd := range info.SheetDetails {
+		for cIdx, col := range sd.Columns {
+			if col.FormulaCount == 0 {
+				continue
+			}
+			formulas = append(formulas, map[string]interface{}{
+				"sheet":            sd.Name,
+				"column_idx":       cIdx + 1,
+				"name":             col.Name,
+				"formula_count":    col.FormulaCount,
+				"formula":          col.Formula,
+				"cross_sheet_refs": strings.Join(col.CrossSheetRefs, "|"),
+			})
 		}
-		cols = append(cols, cp)
+	}
+	return formulas
+}
+
+func (i *Inspector) buildCompactTOONPayloadFull(ctx context.Context, info *FileInfo) (map[string]interface{}, error) {
+	payload, compact := buildCompactTOONPayload(info, i.config.maxSamples)
+	cols, ok := payload["columns"].([]map[string]interface{})
+	if !ok {
+		return payload, nil
 	}
 
+	// idx is the 0-based sheet column, so columns of a table that starts
+	// past column A read their own cells.
 	type colRef struct {
-		sheet string
-		idx   int
-		row   map[string]interface{}
+		sheet      string
+		idx        int
+		start, end int
+		row        map[string]interface{}
 	}
 	refsBySheet := make(map[string][]colRef)
-	for _, c := range cols {
-		sheet, _ := c["sheet"].(string)
-		columnIdx, _ := c["column_idx"].(int)
-		if columnIdx <= 0 {
+	for pos, c := range compact {
+		if c.columnIdx <= 0 {
 			continue
 		}
-		refsBySheet[sheet] = append(refsBySheet[sheet], colRef{
-			sheet: sheet,
-			idx:   columnIdx - 1,
-			row:   c,
+		refsBySheet[c.sheet] = append(refsBySheet[c.sheet], colRef{
+			sheet: c.sheet,
+			idx:   c.left + c.columnIdx - 1,
+			start: c.startRow,
+			end:   c.endRow,
+			row:   cols[pos],
 		})
 	}
 
@@ -560,35 +1137,27 @@ func (i *Inspector) buildCompactTOONPayloadFull(info *FileInfo) map[string]inter
 	doneSheets := 0
 	i.emitProgress("toon_full_values", "", 0, totalSheets)
 	for sheet, refs := range refsBySheet {
-		rows := i.xl.ReadRows(sheet)
+		rows, err := i.sheetRows(ctx, sheet, i.config.maxSampleRows)
+		if err != nil {
+			return nil, err
+		}
 		valuesByCol := make(map[int][]string)
-		rowNum := 0
-		for row := range rows {
-			rowNum++
-			if rowNum > 1000 {
-				break
-			}
-			trimmed := make([]string, len(row.Cells))
-			for idx, cell := range row.Cells {
-				trimmed[idx] = strings.TrimSpace(cell.Value)
-			}
-			trimmed = trimTrailingEmpty(trimmed)
-			if len(trimmed) == 0 || isLikelyHeaderRow(trimmed) || isSectionMarkerRow(trimmed) {
+		for rIdx, row := range rows {
+			trimmed := trimTrailingEmpty(row)
+			if len(trimmed) == 0 || i.detector.isLikelyHeaderRow(trimmed) || i.detector.isSectionMarkerRow(trimmed) {
 				continue
 			}
+			rowNum := rIdx + 1
 			for _, ref := range refs {
-				if ref.idx >= len(trimmed) {
+				if ref.idx >= len(trimmed) || (ref.start > 0 && (rowNum < ref.start || rowNum > ref.end)) {
 					continue
 				}
-				v := strings.TrimSpace(trimmed[ref.idx])
+				v := trimmed[ref.idx]
 				if v == "" {
 					continue
 				}
 				valuesByCol[ref.idx] = append(valuesByCol[ref.idx], v)
 			}
-			if rowNum%100 == 0 || rowNum == 1000 {
-				i.emitProgress("toon_full_values_rows", sheet, rowNum, 1000)
-			}
 		}
 
 		for _, ref := range refs {
@@ -599,7 +1168,7 @@ func (i *Inspector) buildCompactTOONPayloadFull(info *FileInfo) map[string]inter
 	}
 
 	payload["columns"] = cols
-	return payload
+	return payload, nil
 }
 
 func toSampleStrings(values []interface{}) []string {
@@ -608,7 +1177,7 @@ func toSampleStrings(values []interface{}) []string {
 	}
 	out := make([]string, 0, len(values))
 	for _, v := range values {
-		s := strings.TrimSpace(fmt.Sprintf("%v", v))
+		s := strings.TrimSpace(formatValue(v))
 		if s != "" {
 			out = append(out, s)
 		}
@@ -638,142 +1207,188 @@ func mergeSampleStrings(base []string, incoming []string, maxSamples int) []stri
 	return base
 }
 
-func isSectionMarkerRow(row []string) bool {
+func (d *detector) isSectionMarkerRow(row []string) bool {
 	upper := strings.ToUpper(strings.Join(row, " "))
-	if strings.Contains(upper, "CROSS SELLING") || strings.Contains(upper, "NON CROSS SELLING") {
-		return true
-	}
-	if strings.Contains(upper, "LAST UPDATE") || strings.Contains(upper, "HANDOVER") {
-		return true
+	for _, marker := range d.sectionMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
 	}
 	return false
 }
 
-func (i *Inspector) getRowCount(sheetName string) int {
-	rows := i.xl.ReadRows(sheetName)
-	rowCount := 0
-	for range rows {
-		rowCount++
-		if rowCount > 1000 {
-			break
-		}
+func (i *Inspector) inspectSheetDetail(ctx context.Context, sheetName string) (SheetDetail, error) {
+	detail := SheetDetail{
+		Name:       sheetName,
+		Visibility: i.sheetVisibility(sheetName),
 	}
-	return rowCount
-}
 
-func (i *Inspector) getColumnCount(sheetName string) int {
-	rows := i.xl.ReadRows(sheetName)
-	for row := range rows {
-		return len(row.Cells)
+	data, err := i.sheetData(ctx, sheetName)
+	if err != nil {
+		return detail, err
 	}
-	return 0
-}
-
-func (i *Inspector) inspectSheetDetail(sheetName string) SheetDetail {
-	detail := SheetDetail{
-		Name: sheetName,
+	detail.HiddenRows = rowSpanLabels(data.hiddenRows)
+	detail.HiddenColumns = columnSpanLabels(data.hiddenCols)
+	for _, m := range data.merges {
+		detail.MergedCells = append(detail.MergedCells, m.a1())
 	}
+	allRows := data.rows
+	rowCount := len(allRows)
 
-	rows := i.xl.ReadRows(sheetName)
-	rowCount := 0
-	allRows := make([][]string, 0, 1000)
-	maxCols := 0
-	for row := range rows {
-		rowCount++
-		values := make([]string, len(row.Cells))
-		for idx, cell := range row.Cells {
-			values[idx] = strings.TrimSpace(cell.Value)
+	detail.RowCount = rowCount
+	detail.ScannedRows = rowCount
+	detail.Truncated = data.truncated
+	// With row counting disabled the scanned prefix stands in as a lower
+	// bound; Truncated tells consumers it is not the real total.
+	if i.config.includeRowCount {
+		detail.RowCount = data.rowCount()
+	}
+	detail.ColumnCount = data.maxCols
+	scan := &sheetScan{
+		sheet:      sheetName,
+		rows:       allRows,
+		formats:    data.formats,
+		marks:      data.marks,
+		formulas:   data.formulas,
+		merges:     data.merges,
+		maxSamples: i.config.maxSamples,
+		profile:    i.config.profile,
+		typed:      i.config.typedValues,
+		mergeFill:  i.config.mergeFill,
+	}
+	if i.config.headerRow > 0 {
+		// A forced header row replaces detection entirely, including the
+		// first-non-empty-row fallback below and stacked header bands.
+		if i.config.headerRow > rowCount {
+			return detail, nil
 		}
-		if len(values) > maxCols {
-			maxCols = len(values)
+		detail.Sections = i.detector.extractSectionsByHeaderIndexes(scan, []int{i.config.headerRow - 1}, false)
+	} else {
+		// Excel tables define their own sections; detection only looks at
+		// what they leave uncovered.
+		sheet, _ := i.wb.sheet(sheetName)
+		tables, unscanned := scan.tableSections(sheet.tables)
+		detail.UnscannedTables = unscanned
+		rest := scan
+		if len(tables) > 0 {
+			rest = scan.withoutTables(sheet.tables)
 		}
-		allRows = append(allRows, values)
-		if rowCount%100 == 0 || rowCount == 1000 {
-			i.emitProgress("scan_sheet_rows", sheetName, rowCount, 1000)
-		}
-		if rowCount >= 1000 {
-			break
+		sections := i.detector.extractSections(rest)
+		if len(sections) == 0 {
+			sections = i.detector.extractSectionsByScore(rest, rest.headerStyleProbe())
 		}
+		detail.Sections = combineSections(tables, sections)
 	}
-
-	detail.RowCount = rowCount
-	detail.ColumnCount = maxCols
-	detail.Sections = extractSections(allRows)
 	for idx := range detail.Sections {
-		detail.Sections[idx].Rows = buildSectionRows(allRows, detail.Sections[idx])
+		detail.Sections[idx].Rows = scan.sectionRows(detail.Sections[idx])
+		finalizeProfiles(detail.Sections[idx].Columns, i.config.profileTopValues)
 	}
 
 	if len(detail.Sections) > 0 {
+		detail.HeaderConfidence = detail.Sections[0].HeaderConfidence
 		detail.Headers = detail.Sections[0].Headers
 		detail.Columns = detail.Sections[0].Columns
-		return detail
+		return detail, nil
 	}
 
-	// Fallback for simple single-table sheets.
+	// Last resort when no row scores as a header: take the first non-empty
+	// row, with zero confidence.
 	headerRow := findFirstNonEmptyRow(allRows)
 	if headerRow == 0 {
-		return detail
+		return detail, nil
 	}
 	headers := allRows[headerRow-1]
 	detail.Headers = trimTrailingEmpty(headers)
 	detail.ColumnCount = len(detail.Headers)
-	detail.Columns = buildColumnsFromSection(allRows, headerRow, detail.Headers, 5, rowCount)
-	return detail
+	detail.Columns = scan.buildColumns(headerRow, 0, detail.Headers, rowCount)
+	finalizeProfiles(detail.Columns, i.config.profileTopValues)
+	return detail, nil
 }
 
-func buildSectionRows(rows [][]string, section Section) []SectionRow {
+// sectionRows returns the non-empty data rows of section keyed by header.
+func (s *sheetScan) sectionRows(section Section) []SectionRow {
+	rows := s.rows
 	if len(section.Headers) == 0 || section.StartRow <= 0 || section.EndRow < section.StartRow {
 		return nil
 	}
-	out := make([]SectionRow, 0, section.RowCount)
+	out := make([]SectionRow, 0, min(section.RowCount, len(rows)))
+	left := section.firstColumn()
+	filler := newMergeFiller(s.mergeFill, rows, s.merges)
 	for rowNum := section.StartRow; rowNum <= section.EndRow; rowNum++ {
 		if rowNum-1 < 0 || rowNum-1 >= len(rows) {
 			continue
 		}
-		rawRow := rows[rowNum-1]
-		values := make(map[string]string, len(section.Headers))
-		hasData := false
-		for idx, header := range section.Headers {
-			key := strings.TrimSpace(header)
-			if key == "" {
-				continue
-			}
-			v := ""
-			if idx < len(rawRow) {
-				v = strings.TrimSpace(rawRow[idx])
-			}
-			if v != "" {
-				hasData = true
-			}
-			values[key] = v
+		raw := filler.fill(rowNum, rows[rowNum-1])
+		if row, ok := s.sectionRow(section.Headers, rowNum, from(raw, left), from(valueAt(s.formats, rowNum-1), left)); ok {
+			out = append(out, row)
 		}
-		if !hasData {
-			continue
-		}
-		out = append(out, SectionRow{
-			RowNumber: rowNum,
-			Values:    values,
-		})
 	}
 	return out
 }
 
-func (i *Inspector) visibleSheets(sheets []string) []string {
-	out := make([]string, 0, len(sheets))
-	for _, sheetName := range sheets {
-		visible, err := i.file.GetSheetVisible(sheetName)
-		if err != nil || !visible {
+// sectionRow keys the values of worksheet row rowNum by headers, typing them
+// with the row's format kinds. It reports false when the row holds no data
+// under any header.
+func (s *sheetScan) sectionRow(headers []string, rowNum int, rawRow []string, formats []formatKind) (SectionRow, bool) {
+	values := make(map[string]string, len(headers))
+	var typed map[string]interface{}
+	if s.typed {
+		typed = make(map[string]interface{}, len(headers))
+	}
+	hasData := false
+	for idx, header := range headers {
+		key := strings.TrimSpace(header)
+		if key == "" {
 			continue
 		}
-		out = append(out, sheetName)
+		v := ""
+		if idx < len(rawRow) {
+			v = strings.TrimSpace(rawRow[idx])
+		}
+		if v != "" {
+			hasData = true
+		}
+		values[key] = v
+		if typed != nil {
+			typed[key] = typedCellValue(v, inferValueType(v, valueAt(formats, idx)))
+		}
 	}
-	return out
+	if !hasData {
+		return SectionRow{}, false
+	}
+	return SectionRow{
+		RowNumber:   rowNum,
+		Values:      values,
+		TypedValues: typed,
+	}, true
+}
+
+// sheetSelected applies the WithSheetFilter patterns to a sheet name.
+func (i *Inspector) sheetSelected(sheetName string) bool {
+	for _, p := range i.config.sheetExclude {
+		if ok, _ := path.Match(p, sheetName); ok {
+			return false
+		}
+	}
+	if len(i.config.sheetInclude) == 0 {
+		return true
+	}
+	for _, p := range i.config.sheetInclude {
+		if ok, _ := path.Match(p, sheetName); ok {
+			return true
+		}
+	}
+	return false
 }
 
 func (i *Inspector) emitProgress(phase, sheet string, current, total int) {
 	if i.progressCallback == nil && i.progressChan == nil {
 		return
 	}
+	// Sheets inspected concurrently report through here; one event is
+	// delivered at a time.
+	i.progressMu.Lock()
+	defer i.progressMu.Unlock()
 	pct := 0.0
 	if total > 0 {
 		pct = (float64(current) / float64(total)) * 100.0
@@ -802,26 +1417,68 @@ func (i *Inspector) emitProgress(phase, sheet string, current, total int) {
 	}
 }
 
-func extractSections(rows [][]string) []Section {
-	reportHeaderIdx := findReportHeaderRows(rows)
+// sheetScan is the scanned prefix of a sheet that sections are extracted
+// from. rows[n-1] is worksheet row n; formats, marks and formulas hold the
+// number format kinds, marks and formulas of the same cells where they are
+// set.
+type sheetScan struct {
+	sheet      string
+	rows       [][]string
+	formats    [][]formatKind
+	marks      [][]cellMark
+	formulas   [][]*formula
+	merges     []mergeRange
+	maxSamples int
+	profile    bool
+	typed      bool
+	mergeFill  MergeFill
+}
+
+// newSection builds a section from its header band, title, 1-based last row
+// and header confidence.
+func (s *sheetScan) newSection(band headerBand, title string, end int, confidence float64) Section {
+	headers, paths := s.bandHeaders(band)
+	headerRow := band.bottom + 1
+	start := headerRow + 1
+	columns := s.buildColumns(headerRow, 0, headers, end)
+	for idx := range columns {
+		if idx < len(paths) && len(paths[idx]) > 1 {
+			columns[idx].HeaderPath = paths[idx]
+		}
+	}
+	return Section{
+		Title:            title,
+		HeaderRow:        headerRow,
+		HeaderDepth:      band.depth(),
+		HeaderConfidence: confidence,
+		StartRow:         start,
+		EndRow:           end,
+		Headers:          headers,
+		Columns:          columns,
+		RowCount:         max(0, end-start+1),
+		ColumnCount:      len(headers),
+	}
+}
+
+func (d *detector) extractSections(scan *sheetScan) []Section {
+	reportHeaderIdx := d.findReportHeaderRows(scan.rows)
 	if len(reportHeaderIdx) > 0 {
-		sections := extractSectionsByHeaderIndexes(rows, reportHeaderIdx)
-		return mergeReportSections(sections)
+		sections := d.extractSectionsByHeaderIndexes(scan, reportHeaderIdx, true)
+		return d.mergeReportSections(sections, scan.maxSamples)
 	}
 
-	return extractSectionsByHeuristic(rows)
+	return d.extractSectionsByHeuristic(scan)
 }
 
-func extractSectionsByHeuristic(rows [][]string) []Section {
+func (d *detector) extractSectionsByHeuristic(scan *sheetScan) []Section {
+	rows := scan.rows
 	sections := make([]Section, 0)
 	for i := 0; i < len(rows); i++ {
 		current := trimTrailingEmpty(rows[i])
-		if !isLikelyHeaderRow(current) {
+		if !d.isLikelyHeaderRow(current) {
 			continue
 		}
 
-		title := sectionTitleFromRow(rows, i-1)
-
 		start := i + 2
 		end := start - 1
 		for j := start; j <= len(rows); j++ {
@@ -830,7 +1487,7 @@ func extractSectionsByHeuristic(rows [][]string) []Section {
 				break
 			}
 			next := trimTrailingEmpty(rows[j])
-			if isLikelyHeaderRow(next) {
+			if d.isLikelyHeaderRow(next) {
 				end = j
 				break
 			}
@@ -841,31 +1498,21 @@ func extractSectionsByHeuristic(rows [][]string) []Section {
 			end = j + 1
 		}
 
-		headerRow := i + 1
-		headers := current
-		cols := buildColumnsFromSection(rows, headerRow, headers, 5, end)
-		section := Section{
-			Title:       title,
-			HeaderRow:   headerRow,
-			StartRow:    start,
-			EndRow:      end,
-			Headers:     headers,
-			Columns:     cols,
-			RowCount:    max(0, end-start+1),
-			ColumnCount: len(headers),
-		}
-		sections = append(sections, section)
+		band := scan.headerBand(i, end)
+		title := d.sectionTitleFromRow(scan.titleRow(band.top - 1))
+		sections = append(sections, scan.newSection(band, title, end, 1))
 		i = end - 1
 	}
 	return sections
 }
 
-func extractSectionsByHeaderIndexes(rows [][]string, headerIdx []int) []Section {
+// extractSectionsByHeaderIndexes builds one section per 0-based header row
+// index. With stacked set, each header row is grown into a stacked header
+// band from the merged cells around it; a forced header row stays as given.
+func (d *detector) extractSectionsByHeaderIndexes(scan *sheetScan, headerIdx []int, stacked bool) []Section {
+	rows := scan.rows
 	sections := make([]Section, 0, len(headerIdx))
 	for idx, rowIdx := range headerIdx {
-		headers := trimTrailingEmpty(rows[rowIdx])
-		headerRow := rowIdx + 1
-		start := headerRow + 1
 		endExclusive := len(rows)
 		if idx+1 < len(headerIdx) {
 			endExclusive = headerIdx[idx+1]
@@ -875,30 +1522,39 @@ func extractSectionsByHeaderIndexes(rows [][]string, headerIdx []int) []Section
 			end--
 		}
 
-		title := sectionTitleFromRow(rows, rowIdx-1)
-
-		section := Section{
-			Title:       title,
-			HeaderRow:   headerRow,
-			StartRow:    start,
-			EndRow:      end,
-			Headers:     headers,
-			Columns:     buildColumnsFromSection(rows, headerRow, headers, 5, end),
-			RowCount:    max(0, end-start+1),
-			ColumnCount: len(headers),
+		band := headerBand{top: rowIdx, bottom: rowIdx}
+		if stacked {
+			band = scan.headerBand(rowIdx, end)
 		}
-		sections = append(sections, section)
+		title := d.sectionTitleFromRow(scan.titleRow(band.top - 1))
+		sections = append(sections, scan.newSection(band, title, end, 1))
 	}
 	return sections
 }
 
-func buildColumnsFromSection(rows [][]string, headerRow int, headers []string, maxSamples int, stopAtRow int) []ColumnInfo {
+// buildColumns describes the columns under a header row whose first column
+// is the 0-based sheet column left, taking samples and inferring types from
+// the data rows up to the 1-based stopAtRow.
+func (s *sheetScan) buildColumns(headerRow, left int, headers []string, stopAtRow int) []ColumnInfo {
+	rows := s.rows
 	columns := make([]ColumnInfo, len(headers))
+	stats := make([]columnTypeStats, len(headers))
+	var formulas []*formulaStats
+	if s.formulas != nil {
+		formulas = make([]*formulaStats, len(headers))
+	}
 	for colIdx, header := range headers {
 		columns[colIdx] = ColumnInfo{
 			Name:          header,
-			StartPosition: fmt.Sprintf("%s%d", columnLetter(colIdx), headerRow),
-			SampleValues:  make([]interface{}, 0, maxSamples),
+			StartPosition: fmt.Sprintf("%s%d", columnLetter(left+colIdx), headerRow),
+			SampleValues:  make([]interface{}, 0, s.maxSamples),
+		}
+		stats[colIdx] = make(columnTypeStats)
+		if formulas != nil {
+			formulas[colIdx] = newFormulaStats(s.sheet)
+		}
+		if s.profile {
+			columns[colIdx].profiler = newColumnProfiler()
 		}
 	}
 
@@ -907,26 +1563,48 @@ func buildColumnsFromSection(rows [][]string, headerRow int, headers []string, m
 		stopAtRow = len(rows)
 	}
 	for rowIdx := dataStart; rowIdx <= stopAtRow; rowIdx++ {
-		row := rows[rowIdx-1]
+		row := from(rows[rowIdx-1], left)
+		if isEmptyRow(row) {
+			continue
+		}
 		for colIdx := range headers {
-			if colIdx >= len(row) {
-				continue
+			v := ""
+			if colIdx < len(row) {
+				v = row[colIdx]
+			}
+			col := left + colIdx
+			dataType := inferValueType(v, formatKindAt(s.formats, rowIdx, col))
+			stats[colIdx].add(dataType)
+			if formulas != nil {
+				formulas[colIdx].add(valueAt(valueAt(s.formulas, rowIdx-1), col), rowIdx, col)
+			}
+			if p := columns[colIdx].profiler; p != nil {
+				p.add(v, s.markAt(rowIdx, col)&markBlank != 0, dataType)
 			}
-			v := strings.TrimSpace(row[colIdx])
-			if v == "" || len(columns[colIdx].SampleValues) >= maxSamples {
+			if v == "" || len(columns[colIdx].SampleValues) >= s.maxSamples {
 				continue
 			}
-			columns[colIdx].SampleValues = append(columns[colIdx].SampleValues, v)
-			if columns[colIdx].DataType == "" {
-				columns[colIdx].DataType = getDataType(v)
+			if s.typed {
+				columns[colIdx].SampleValues = append(columns[colIdx].SampleValues, typedCellValue(v, dataType))
+			} else {
+				columns[colIdx].SampleValues = append(columns[colIdx].SampleValues, v)
 			}
 		}
 	}
+	for colIdx := range columns {
+		columns[colIdx].DataType = stats[colIdx].dominant()
+		if len(stats[colIdx]) > 0 {
+			columns[colIdx].TypeCounts = stats[colIdx]
+		}
+		if formulas != nil {
+			formulas[colIdx].apply(&columns[colIdx])
+		}
+	}
 	return columns
 }
 
-func isLikelyHeaderRow(row []string) bool {
-	if len(row) < 3 {
+func (d *detector) isLikelyHeaderRow(row []string) bool {
+	if len(row) < d.minCells {
 		return false
 	}
 	nonEmpty := 0
@@ -937,27 +1615,27 @@ func isLikelyHeaderRow(row []string) bool {
 			continue
 		}
 		nonEmpty++
-		if isKnownHeaderToken(v) {
+		if d.headerTokens[v] {
 			known++
 		}
 	}
-	if nonEmpty < 3 {
+	if nonEmpty < d.minCells {
 		return false
 	}
-	return known >= 2
+	return known >= d.minMatches
 }
 
-func findReportHeaderRows(rows [][]string) []int {
+func (d *detector) findReportHeaderRows(rows [][]string) []int {
 	idx := make([]int, 0)
 	for i, row := range rows {
 		normalized := normalizeRow(row)
-		if len(normalized) < 3 {
-			continue
-		}
-		if !containsToken(normalized, "MERK") || !containsToken(normalized, "TYPE") {
+		if len(normalized) < d.minCells {
 			continue
 		}
-		if !containsAnyToken(normalized, "TRANSMITION", "TRANSMISSION", "YEAR", "ODOMETER", "STNK", "PURCHASE DATE") {
+		matched := matchTokenRule(d.reportAllOf, d.reportAnyOf, func(token string) bool {
+			return containsToken(normalized, token)
+		})
+		if !matched {
 			continue
 		}
 		idx = append(idx, i)
@@ -985,27 +1663,6 @@ func containsToken(row []string, token string) bool {
 	return false
 }
 
-func containsAnyToken(row []string, tokens ...string) bool {
-	for _, t := range tokens {
-		if containsToken(row, t) {
-			return true
-		}
-	}
-	return false
-}
-
-func isKnownHeaderToken(v string) bool {
-	switch v {
-	case "MERK", "TYPE", "TRANSMITION", "TRANSMISSION", "YEAR", "COLOR", "ODOMETER", "STNK",
-		"PURCHASE DATE", "AGING", "CREDIT PRICE", "CASH PRICE", "SELLING PRICE", "MARKET PRICE",
-		"TOTAL NILAI STOCK (EST.)", "TOTAL NILAI STOCK (ACT.)", "NOTES DOCUMENT", "MR2",
-		"NO", "STATUS", "PLATE NO", "PLATE NO ", "UNIT CATEGORY":
-		return true
-	default:
-		return false
-	}
-}
-
 func trimTrailingEmpty(row []string) []string {
 	last := -1
 	for i, cell := range row {
@@ -1052,12 +1709,9 @@ func firstNonEmpty(row []string) string {
 	return ""
 }
 
-func sectionTitleFromRow(rows [][]string, rowIdx int) string {
-	if rowIdx < 0 || rowIdx >= len(rows) {
-		return ""
-	}
+func (d *detector) sectionTitleFromRow(row []string) string {
 	tokens := make([]string, 0)
-	for _, cell := range rows[rowIdx] {
+	for _, cell := range row {
 		v := strings.TrimSpace(cell)
 		if v != "" {
 			tokens = append(tokens, v)
@@ -1072,13 +1726,11 @@ func sectionTitleFromRow(rows [][]string, rowIdx int) string {
 		upper[i] = strings.ToUpper(t)
 	}
 
-	if idx := indexOfContains(upper, "CROSS SELLING"); idx >= 0 {
-		start := max(0, idx-2)
-		return strings.Join(tokens[start:idx+1], " ")
-	}
-	if idx := indexOfContains(upper, "NON CROSS SELLING"); idx >= 0 {
-		start := max(0, idx-2)
-		return strings.Join(tokens[start:idx+1], " ")
+	for _, marker := range d.titleMarkers {
+		if idx := indexOfContains(upper, marker); idx >= 0 {
+			start := max(0, idx-2)
+			return strings.Join(tokens[start:idx+1], " ")
+		}
 	}
 	if len(tokens) >= 2 {
 		return strings.Join(tokens[:2], " ")
@@ -1095,7 +1747,7 @@ func indexOfContains(values []string, pattern string) int {
 	return -1
 }
 
-func mergeReportSections(sections []Section) []Section {
+func (d *detector) mergeReportSections(sections []Section, maxSamples int) []Section {
 	if len(sections) == 0 {
 		return sections
 	}
@@ -1103,7 +1755,7 @@ func mergeReportSections(sections []Section) []Section {
 	merged := make([]Section, 0, len(sections))
 	indexByKey := make(map[string]int)
 	for _, sec := range sections {
-		key := reportSectionKey(sec)
+		key := d.reportSectionKey(sec)
 		if key == "" {
 			merged = append(merged, sec)
 			continue
@@ -1120,17 +1772,17 @@ func mergeReportSections(sections []Section) []Section {
 		// Keep StartRow/EndRow from the first observed block to avoid
 		// implying a continuous range when repeated blocks are non-contiguous.
 		base.RowCount += sec.RowCount
-		base.Columns = mergeColumnSamples(base.Columns, sec.Columns, 5)
+		base.Columns = mergeColumnSamples(base.Columns, sec.Columns, maxSamples)
 	}
 	return merged
 }
 
-func reportSectionKey(sec Section) string {
+func (d *detector) reportSectionKey(sec Section) string {
 	title := strings.ToUpper(strings.TrimSpace(sec.Title))
-	if !strings.Contains(title, "HANDOVER") {
-		return ""
-	}
-	if !(strings.Contains(title, "CROSS SELLING") || strings.Contains(title, "NON CROSS SELLING")) {
+	matched := matchTokenRule(d.mergeAllOf, d.mergeAnyOf, func(token string) bool {
+		return strings.Contains(title, token)
+	})
+	if !matched {
 		return ""
 	}
 	// Keep this strict so only HQ-like report sections are merged.
@@ -1143,8 +1795,19 @@ func mergeColumnSamples(base []ColumnInfo, incoming []ColumnInfo, maxSamples int
 		limit = len(incoming)
 	}
 	for i := 0; i < limit; i++ {
-		if base[i].DataType == "" && incoming[i].DataType != "" {
-			base[i].DataType = incoming[i].DataType
+		if len(incoming[i].TypeCounts) > 0 {
+			base[i].TypeCounts = addTypeCounts(base[i].TypeCounts, incoming[i].TypeCounts)
+			base[i].DataType = columnTypeStats(base[i].TypeCounts).dominant()
+		}
+		if base[i].profiler != nil {
+			base[i].profiler.merge(incoming[i].profiler)
+		}
+		base[i].FormulaCount += incoming[i].FormulaCount
+		if base[i].Formula == "" {
+			base[i].Formula = incoming[i].Formula
+		}
+		for _, ref := range incoming[i].CrossSheetRefs {
+			base[i].CrossSheetRefs = appendUnique(base[i].CrossSheetRefs, ref)
 		}
 		if base[i].SampleValues == nil {
 			base[i].SampleValues = make([]interface{}, 0, maxSamples)
@@ -1180,20 +1843,6 @@ func findFirstNonEmptyRow(rows [][]string) int {
 	return 0
 }
 
-func getDataType(value string) string {
-	if value == "" {
-		return "empty"
-	}
-
-	for _, r := range value {
-		if r >= '0' && r <= '9' || r == '.' || r == '-' || r == '+' || r == 'e' || r == 'E' {
-			continue
-		}
-		return "string"
-	}
-	return "number"
-}
-
 func columnLetter(colIdx int) string {
 	result := ""
 	for {
@@ -0,0 +1,197 @@
+package excelinspect
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testSheet is a worksheet of an .xlsx fixture: its sheetData rows, the
+// elements that follow sheetData (mergeCells, tableParts) and, for tables,
+// the relationships of the worksheet part.
+type testSheet struct {
+	name  string
+	state string
+	rows  string
+	extra string
+	rels  string
+}
+
+// testStyles has four cell formats: 0 General, 1 bold, 2 a date and 3 a
+// bottom border.
+const testStyles = `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><fonts count="2"><font/><font><b/></font></fonts><borders count="2"><border><bottom/></border><border><bottom style="thin"/></border></borders><cellXfs count="4"><xf numFmtId="0" fontId="0" borderId="0"/><xf numFmtId="0" fontId="1" borderId="0"/><xf numFmtId="14" fontId="0" borderId="0"/><xf numFmtId="0" fontId="0" borderId="1"/></cellXfs></styleSheet>`
+
+// xlsxFile returns an .xlsx package with sheets. names is the content of
+// the workbook's definedNames element, if any; parts are added as given.
+func xlsxFile(tb testing.TB, sheets []testSheet, names string, parts map[string]string) []byte {
+	tb.Helper()
+	var wb, rels strings.Builder
+	all := map[string]string{"xl/styles.xml": testStyles}
+	for idx, s := range sheets {
+		state := ""
+		if s.state != "" {
+			state = fmt.Sprintf(` state="%s"`, s.state)
+		}
+		fmt.Fprintf(&wb, `<sheet name="%s" sheetId="%d"%s r:id="rId%d"/>`, s.name, idx+1, state, idx+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, idx+1, idx+1)
+		all[fmt.Sprintf("xl/worksheets/sheet%d.xml", idx+1)] = `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetData>` + s.rows + `</sheetData>` + s.extra + `</worksheet>`
+		if s.rels != "" {
+			all[fmt.Sprintf("xl/worksheets/_rels/sheet%d.xml.rels", idx+1)] = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + s.rels + `</Relationships>`
+		}
+	}
+	if names != "" {
+		names = "<definedNames>" + names + "</definedNames>"
+	}
+	all["xl/workbook.xml"] = `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` + wb.String() + `</sheets>` + names + `</workbook>`
+	all["xl/_rels/workbook.xml.rels"] = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels.String() + `</Relationships>`
+	for name, data := range parts {
+		all[name] = data
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range all {
+		w, err := zw.Create(name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// xrow encodes worksheet row n with values from column A on. Empty values
+// are left out; numbers are stored as numbers and anything else as an
+// inline string. style is the cell format of every cell.
+func xrow(n, style int, values ...string) string {
+	return xrowAt(n, 0, style, values...)
+}
+
+// xrowAt is xrow with the first value in the 0-based column left.
+func xrowAt(n, left, style int, values ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, n)
+	for idx, v := range values {
+		if v == "" {
+			continue
+		}
+		ref := fmt.Sprintf("%s%d", columnLetter(left+idx), n)
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, v)
+		} else {
+			fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t>%s</t></is></c>`, ref, style, v)
+		}
+	}
+	b.WriteString("</row>")
+	return b.String()
+}
+
+// openTestWorkbook opens an .xlsx fixture with opts.
+func openTestWorkbook(tb testing.TB, data []byte, opts ...InspectorOption) *Inspector {
+	tb.Helper()
+	ins, err := NewFromBytes(data, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { ins.Close() })
+	return ins
+}
+
+func TestSparseCellsKeepTheirPosition(t *testing.T) {
+	// B1, C1 and row 3 are not in the file.
+	rows := `<row r="1"><c r="A1" t="inlineStr"><is><t>NAME</t></is></c><c r="D1" t="inlineStr"><is><t>PRICE</t></is></c></row>` +
+		`<row r="2"><c r="A2" t="inlineStr"><is><t>Bolt</t></is></c><c r="D2"><v>10</v></c></row>` +
+		`<row r="4"><c r="A4" t="inlineStr"><is><t>Nut</t></is></c><c r="D4"><v>20</v></c></row>`
+	ins := openTestWorkbook(t, xlsxFile(t, []testSheet{{name: "Parts", rows: rows}}, "", nil), WithHeaderRow(1))
+
+	d, err := ins.sheetData(context.Background(), "Parts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRows := [][]string{{"NAME", "", "", "PRICE"}, {"Bolt", "", "", "10"}, nil, {"Nut", "", "", "20"}}
+	if !reflect.DeepEqual(d.rows, wantRows) {
+		t.Errorf("rows = %q, want %q", d.rows, wantRows)
+	}
+
+	detail, err := ins.inspectSheetDetail(context.Background(), "Parts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detail.Sections) != 1 {
+		t.Fatalf("sections = %d, want 1", len(detail.Sections))
+	}
+	sec := detail.Sections[0]
+	positions := make(map[string]string)
+	for _, c := range sec.Columns {
+		positions[c.Name] = c.StartPosition
+	}
+	if positions["NAME"] != "A1" || positions["PRICE"] != "D1" {
+		t.Errorf("start positions = %v, want NAME A1 and PRICE D1", positions)
+	}
+	var numbers []int
+	for _, r := range sec.Rows {
+		numbers = append(numbers, r.RowNumber)
+	}
+	if !reflect.DeepEqual(numbers, []int{2, 4}) {
+		t.Errorf("row numbers = %v, want [2 4]", numbers)
+	}
+	if got := sec.Rows[1].Values["PRICE"]; got != "20" {
+		t.Errorf("PRICE of row 4 = %q, want 20", got)
+	}
+}
+
+func TestTOONSamplesOfTableColumns(t *testing.T) {
+	// The table covers C2:E10; columns A and B hold other values on the
+	// same rows, which must not leak into its samples.
+	rows := xrow(1, 0, "REPORT")
+	rows += xrow(2, 0, "other", "other", "ITEM", "QTY", "NOTE")
+	want := map[string][]string{}
+	for n := 3; n <= 10; n++ {
+		item, qty, note := fmt.Sprintf("it%d", n), strconv.Itoa(n*10), fmt.Sprintf("n%d", n)
+		rows += xrow(n, 0, fmt.Sprintf("a%d", n), fmt.Sprintf("b%d", n), item, qty, note)
+		want["ITEM"] = append(want["ITEM"], item)
+		want["QTY"] = append(want["QTY"], qty)
+		want["NOTE"] = append(want["NOTE"], note)
+	}
+	sheet := testSheet{
+		name:  "Stock",
+		rows:  rows,
+		extra: `<tableParts count="1"><tablePart r:id="rId1"/></tableParts>`,
+		rels:  `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/table" Target="../tables/table1.xml"/>`,
+	}
+	parts := map[string]string{
+		"xl/tables/table1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<table xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" id="1" name="Table1" displayName="Stock" ref="C2:E10"><tableColumns count="3"><tableColumn id="1" name="ITEM"/><tableColumn id="2" name="QTY"/><tableColumn id="3" name="NOTE"/></tableColumns></table>`,
+	}
+	ins := openTestWorkbook(t, xlsxFile(t, []testSheet{sheet}, "", parts))
+	info, err := ins.InspectWithDetails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := ins.buildCompactTOONPayloadFull(context.Background(), info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for _, c := range payload["columns"].([]map[string]interface{}) {
+		if pos := c["start_position"].(string); pos == "C2" || pos == "D2" || pos == "E2" {
+			got[c["name"].(string)] = strings.Split(c["samples"].(string), "|")
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("samples = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,165 @@
+package excelinspect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RowRecord is one line of the NDJSON row export: a section row together
+// with the sheet and section it belongs to. SectionIndex is 1-based within
+// the sheet.
+type RowRecord struct {
+	Sheet        string                 `json:"sheet"`
+	Section      string                 `json:"section"`
+	SectionIndex int                    `json:"section_index"`
+	RowNumber    int                    `json:"row_number"`
+	Values       map[string]string      `json:"values"`
+	TypedValues  map[string]interface{} `json:"typed_values,omitempty"`
+}
+
+// InspectJSON returns the result of Inspect as JSON, indented when pretty is
+// set and on a single line otherwise.
+func (i *Inspector) InspectJSON(pretty bool) (string, error) {
+	return i.InspectJSONContext(context.Background(), pretty)
+}
+
+func (i *Inspector) InspectJSONContext(ctx context.Context, pretty bool) (string, error) {
+	info, err := i.InspectContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return marshalJSON(info, pretty)
+}
+
+// InspectWithDetailsJSON returns the result of InspectWithDetails as JSON,
+// indented when pretty is set and on a single line otherwise.
+func (i *Inspector) InspectWithDetailsJSON(pretty bool) (string, error) {
+	return i.InspectWithDetailsJSONContext(context.Background(), pretty)
+}
+
+func (i *Inspector) InspectWithDetailsJSONContext(ctx context.Context, pretty bool) (string, error) {
+	info, err := i.InspectWithDetailsContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return marshalJSON(info, pretty)
+}
+
+func marshalJSON(v interface{}, pretty bool) (string, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if pretty {
+		data, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal json: %w", err)
+	}
+	return string(data), nil
+}
+
+// WriteSectionRowsNDJSON writes every section row of every inspected sheet to
+// w as newline-delimited JSON, one RowRecord per line. Sheets are processed
+// one at a time and rows are written as they are produced. A sheet read for
+// the export is dropped from the Inspector's cache once its rows are
+// written, so only one sheet's scanned prefix is held in memory beyond the
+// sheets an earlier call already read.
+//
+// Sections are detected on the first WithMaxSampleRows rows as usual. When a
+// sheet is longer and its last section runs to the end of that prefix, the
+// rest of the sheet is streamed into that section.
+func (i *Inspector) WriteSectionRowsNDJSON(w io.Writer) error {
+	return i.WriteSectionRowsNDJSONContext(context.Background(), w)
+}
+
+func (i *Inspector) WriteSectionRowsNDJSONContext(ctx context.Context, w io.Writer) error {
+	ctx, cancel := i.timeoutContext(ctx)
+	defer cancel()
+
+	enc := json.NewEncoder(w)
+	sheets, _ := i.selectSheets(i.wb.sheetNames())
+	total := len(sheets)
+	i.emitProgress("ndjson_rows", "", 0, total)
+	for idx, sheetName := range sheets {
+		cached := i.cachedSheet(sheetName) != nil
+		detail, err := i.inspectSheetDetail(ctx, sheetName)
+		if err != nil {
+			return err
+		}
+		for sIdx, sec := range detail.Sections {
+			for _, row := range sec.Rows {
+				if err := enc.Encode(newRowRecord(sheetName, sIdx, sec, row)); err != nil {
+					return fmt.Errorf("failed to write row %d of sheet %q: %w", row.RowNumber, sheetName, err)
+				}
+			}
+		}
+		if err := i.streamRemainingRows(ctx, enc, detail); err != nil {
+			return err
+		}
+		if !cached {
+			i.evictSheet(sheetName)
+		}
+		i.emitProgress("ndjson_rows", sheetName, idx+1, total)
+	}
+	return nil
+}
+
+// streamRemainingRows writes the rows past the scanned prefix of a truncated
+// sheet as rows of its last section, if that section reaches the end of the
+// prefix.
+func (i *Inspector) streamRemainingRows(ctx context.Context, enc *json.Encoder, detail SheetDetail) error {
+	if !detail.Truncated || len(detail.Sections) == 0 {
+		return nil
+	}
+	sIdx := len(detail.Sections) - 1
+	sec := detail.Sections[sIdx]
+	if sec.EndRow < detail.ScannedRows {
+		return nil
+	}
+
+	scan := &sheetScan{typed: i.config.typedValues}
+	left := sec.firstColumn()
+	filler, err := i.mergeFiller(ctx, detail.Name)
+	if err != nil {
+		return err
+	}
+	var writeErr error
+	err = i.scanSheetRows(ctx, detail.Name, func(r sheetRow) bool {
+		if r.Number <= detail.ScannedRows {
+			return true
+		}
+		// A table ends where its definition says.
+		if sec.Table != "" && r.Number > sec.EndRow {
+			return false
+		}
+		row, ok := scan.sectionRow(sec.Headers, r.Number, from(filler.fill(r.Number, r.Values), left), from(r.formats, left))
+		if !ok {
+			return true
+		}
+		if err := enc.Encode(newRowRecord(detail.Name, sIdx, sec, row)); err != nil {
+			writeErr = fmt.Errorf("failed to write row %d of sheet %q: %w", r.Number, detail.Name, err)
+			return false
+		}
+		return true
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+func newRowRecord(sheet string, sectionIdx int, sec Section, row SectionRow) RowRecord {
+	return RowRecord{
+		Sheet:        sheet,
+		Section:      sec.Title,
+		SectionIndex: sectionIdx + 1,
+		RowNumber:    row.RowNumber,
+		Values:       row.Values,
+		TypedValues:  row.TypedValues,
+	}
+}
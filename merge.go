@@ -0,0 +1,177 @@
+package excelinspect
+
+import (
+	"context"
+	"strings"
+)
+
+// mergeRange is a merged cell range with 0-based, inclusive bounds.
+type mergeRange struct {
+	top    int
+	left   int
+	bottom int
+	right  int
+}
+
+func (m mergeRange) contains(row, col int) bool {
+	return row >= m.top && row <= m.bottom && col >= m.left && col <= m.right
+}
+
+// parseMergeRef parses a merge reference such as "B2:D3".
+func parseMergeRef(ref string) (mergeRange, bool) {
+	first, last, ok := strings.Cut(ref, ":")
+	if !ok {
+		last = first
+	}
+	c1, r1, err := cellCoordinates(first)
+	if err != nil {
+		return mergeRange{}, false
+	}
+	c2, r2, err := cellCoordinates(last)
+	if err != nil {
+		return mergeRange{}, false
+	}
+	return mergeRange{
+		top:    min(r1, r2) - 1,
+		left:   min(c1, c2),
+		bottom: max(r1, r2) - 1,
+		right:  max(c1, c2),
+	}, true
+}
+
+// a1 returns the range in A1 notation, such as "B2:D3".
+func (m mergeRange) a1() string {
+	return refArea{top: m.top + 1, left: m.left, bottom: m.bottom + 1, right: m.right}.a1()
+}
+
+// MergeFill selects which cells covered by a merged range take the value of
+// its top-left cell when section rows are materialized.
+type MergeFill uint8
+
+const (
+	// MergeFillNone leaves covered cells empty, as the file stores them.
+	MergeFillNone MergeFill = 0
+	// MergeFillDown fills the cells below the top-left cell, in the range's
+	// first column, as for group labels merged over several rows.
+	MergeFillDown MergeFill = 1 << 0
+	// MergeFillAcross fills the cells right of the top-left cell, in the
+	// range's first row, as for labels merged over several columns.
+	MergeFillAcross MergeFill = 1 << 1
+	// MergeFillAll fills every cell of the range.
+	MergeFillAll = MergeFillDown | MergeFillAcross
+)
+
+// WithMergedCellFill propagates the value of each merged range into the
+// cells it covers in SectionRow.Values and TypedValues, Markdown section
+// tables and the NDJSON row export. Detection, samples and types still see
+// the cells as stored. The default is MergeFillNone.
+func WithMergedCellFill(mode MergeFill) InspectorOption {
+	return func(i *Inspector) {
+		i.config.mergeFill = mode & MergeFillAll
+	}
+}
+
+// mergeFiller fills the cells covered by merged ranges as rows are
+// materialized. A range's top-left value is read from rows when its row was
+// scanned, and otherwise remembered when fill meets its row, so rows past the
+// scanned prefix must be filled in order.
+type mergeFiller struct {
+	mode   MergeFill
+	rows   [][]string
+	merges []mergeRange
+	seen   map[int]string
+}
+
+// newMergeFiller returns a filler over the scanned rows and merged ranges of
+// a sheet, or nil when mode fills nothing.
+func newMergeFiller(mode MergeFill, rows [][]string, merges []mergeRange) *mergeFiller {
+	if mode == MergeFillNone || len(merges) == 0 {
+		return nil
+	}
+	return &mergeFiller{mode: mode, rows: rows, merges: merges, seen: make(map[int]string)}
+}
+
+// fill returns worksheet row rowNum with its covered cells filled, or row
+// itself when it has none to fill. Cells holding a value are kept.
+func (f *mergeFiller) fill(rowNum int, row []string) []string {
+	if f == nil {
+		return row
+	}
+	r := rowNum - 1
+	filled, copied := row, false
+	for idx, m := range f.merges {
+		if r < m.top || r > m.bottom {
+			continue
+		}
+		v := f.topLeft(idx, m, r, row)
+		if v == "" || (r > m.top && f.mode&MergeFillDown == 0) {
+			continue
+		}
+		right := m.right
+		if f.mode&MergeFillAcross == 0 {
+			right = m.left
+		}
+		for c := m.left; c <= right; c++ {
+			if (r == m.top && c == m.left) || valueAt(filled, c) != "" {
+				continue
+			}
+			if !copied {
+				filled, copied = append([]string(nil), row...), true
+			}
+			filled = setAt(filled, c, v)
+		}
+	}
+	return filled
+}
+
+// topLeft returns the value of merge idx's top-left cell, seen from row r.
+func (f *mergeFiller) topLeft(idx int, m mergeRange, r int, row []string) string {
+	switch {
+	case r == m.top:
+		v := valueAt(row, m.left)
+		f.seen[idx] = v
+		return v
+	case m.top < len(f.rows):
+		return valueAt(f.rows[m.top], m.left)
+	}
+	return f.seen[idx]
+}
+
+// mergeFiller returns the filler of a sheet's merged cells for
+// WithMergedCellFill, or nil when the option is off.
+func (i *Inspector) mergeFiller(ctx context.Context, sheetName string) (*mergeFiller, error) {
+	if i.config.mergeFill == MergeFillNone {
+		return nil, nil
+	}
+	data, err := i.sheetData(ctx, sheetName)
+	if err != nil {
+		return nil, err
+	}
+	return newMergeFiller(i.config.mergeFill, data.rows, data.merges), nil
+}
+
+// titleRow returns row idx as section titles are read from it: a cell under
+// a merged range that starts in an earlier row, in the range's first column,
+// reads as the range's value, so a title merged over several rows is found
+// from any of them.
+func (s *sheetScan) titleRow(idx int) []string {
+	if idx < 0 || idx >= len(s.rows) {
+		return nil
+	}
+	row := s.rows[idx]
+	copied := false
+	for _, m := range s.merges {
+		if idx <= m.top || idx > m.bottom || valueAt(row, m.left) != "" {
+			continue
+		}
+		v := valueAt(valueAt(s.rows, m.top), m.left)
+		if v == "" {
+			continue
+		}
+		if !copied {
+			row, copied = append([]string(nil), row...), true
+		}
+		row = setAt(row, m.left, v)
+	}
+	return row
+}
@@ -0,0 +1,113 @@
+package excelinspect
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMergedCellFill(t *testing.T) {
+	// A2:A3 is merged down, C2:D2 across and A4:B5 both ways.
+	rows := xrow(1, 0, "REGION", "CITY", "Q1", "Q2") +
+		xrow(2, 0, "West", "Reno", "10") +
+		xrow(3, 0, "", "Boise", "5", "6") +
+		xrow(4, 0, "East", "", "7", "8") +
+		xrow(5, 0, "", "", "9", "10")
+	sheet := testSheet{name: "Sales", rows: rows, extra: mergeCells("A2:A3", "C2:D2", "A4:B5")}
+	data := xlsxFile(t, []testSheet{sheet}, "", nil)
+
+	tests := []struct {
+		name string
+		mode MergeFill
+		want [][]string
+	}{
+		{"none", MergeFillNone, [][]string{
+			{"West", "Reno", "10", ""},
+			{"", "Boise", "5", "6"},
+			{"East", "", "7", "8"},
+			{"", "", "9", "10"},
+		}},
+		{"down", MergeFillDown, [][]string{
+			{"West", "Reno", "10", ""},
+			{"West", "Boise", "5", "6"},
+			{"East", "", "7", "8"},
+			{"East", "", "9", "10"},
+		}},
+		{"across", MergeFillAcross, [][]string{
+			{"West", "Reno", "10", "10"},
+			{"", "Boise", "5", "6"},
+			{"East", "East", "7", "8"},
+			{"", "", "9", "10"},
+		}},
+		{"all", MergeFillAll, [][]string{
+			{"West", "Reno", "10", "10"},
+			{"West", "Boise", "5", "6"},
+			{"East", "East", "7", "8"},
+			{"East", "East", "9", "10"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ins := openTestWorkbook(t, data, WithHeaderRow(1), WithMergedCellFill(tt.mode))
+			detail, err := ins.inspectSheetDetail(context.Background(), "Sales")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sec := detail.Sections[0]
+			var got [][]string
+			for _, r := range sec.Rows {
+				got = append(got, []string{r.Values["REGION"], r.Values["CITY"], r.Values["Q1"], r.Values["Q2"]})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+
+			// Samples and types come from the cells as stored, whatever the
+			// fill mode.
+			columns := make(map[string]ColumnInfo)
+			for _, c := range sec.Columns {
+				columns[c.Name] = c
+			}
+			if got := columns["REGION"].SampleValues; !reflect.DeepEqual(got, []interface{}{"West", "East"}) {
+				t.Errorf("REGION samples = %v, want [West East]", got)
+			}
+			if got := columns["Q2"].TypeCounts[DataTypeInteger]; got != 3 {
+				t.Errorf("Q2 integers = %d, want 3", got)
+			}
+		})
+	}
+}
+
+func TestTitleRow(t *testing.T) {
+	scan := &sheetScan{
+		rows: [][]string{
+			{"CROSS SELLING", "", "Q1"},
+			{},
+			{"", "", ""},
+			{"NO", "MERK", "TYPE"},
+		},
+		merges: []mergeRange{
+			{top: 0, left: 0, bottom: 2, right: 1},
+			{top: 0, left: 2, bottom: 1, right: 2},
+		},
+	}
+	tests := []struct {
+		idx  int
+		want []string
+	}{
+		{0, []string{"CROSS SELLING", "", "Q1"}},
+		{1, []string{"CROSS SELLING", "", "Q1"}},
+		{2, []string{"CROSS SELLING", "", ""}},
+		{3, []string{"NO", "MERK", "TYPE"}},
+		{4, nil},
+	}
+	for _, tt := range tests {
+		if got := scan.titleRow(tt.idx); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("titleRow(%d) = %q, want %q", tt.idx, got, tt.want)
+		}
+	}
+	// The scanned rows themselves are left as stored.
+	if len(scan.rows[1]) != 0 || scan.rows[2][0] != "" {
+		t.Errorf("rows changed to %q", scan.rows)
+	}
+}
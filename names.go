@@ -0,0 +1,127 @@
+package excelinspect
+
+import (
+	"context"
+	"strings"
+)
+
+// ScopeWorkbook is the DefinedName.Scope of names visible from every sheet.
+const ScopeWorkbook = "workbook"
+
+// DefinedName is a named range, constant or formula of the workbook. Scope is
+// ScopeWorkbook or the name of the sheet the name belongs to. RefersTo is the
+// name's expression as the file stores it. Range is the cells it refers to,
+// as "Sheet!A1:B5", when the expression is a single reference; relative
+// references are taken from cell A1. SampleValues holds the first non-empty
+// values of Range within the scanned rows of its sheet and is only set by
+// InspectWithDetails.
+type DefinedName struct {
+	Name         string   `json:"name"`
+	Scope        string   `json:"scope"`
+	RefersTo     string   `json:"refers_to"`
+	Range        string   `json:"range,omitempty"`
+	Hidden       bool     `json:"hidden,omitempty"`
+	SampleValues []string `json:"sample_values,omitempty"`
+}
+
+// workbookName is a defined name as the workbook declares it. ref is the
+// reference its expression consists of, when hasRef is set.
+type workbookName struct {
+	name     string
+	scope    string
+	refersTo string
+	hidden   bool
+	ref      formulaRef
+	hasRef   bool
+}
+
+// newWorkbookName returns the name with the given .xlsx expression (A1
+// notation, without a leading "=").
+func newWorkbookName(name, scope, refersTo string, hidden bool) workbookName {
+	n := workbookName{name: name, scope: scope, refersTo: refersTo, hidden: hidden}
+	f := parseA1Formula(strings.TrimPrefix(strings.TrimSpace(refersTo), "="), 1, 0)
+	if len(f.refs) == 1 {
+		var b strings.Builder
+		b.WriteByte('=')
+		f.refs[0].r1c1(&b)
+		n.ref, n.hasRef = f.refs[0], b.String() == f.text
+	}
+	return n
+}
+
+// newODSName returns the workbook-level named range of an .ods file with the
+// given cell range address, such as "$Sheet1.$A$1:.$B$5".
+func newODSName(name, address string) workbookName {
+	n := workbookName{name: name, scope: ScopeWorkbook, refersTo: address}
+	n.ref, n.hasRef = parseODSRef(address, 1, 0)
+	return n
+}
+
+// area returns the cells the name refers to. A reference without a sheet
+// belongs to the name's own sheet.
+func (n workbookName) area() (refArea, bool) {
+	if !n.hasRef {
+		return refArea{}, false
+	}
+	area := n.ref.resolve(1, 0)
+	if area.sheet == "" {
+		if n.scope == ScopeWorkbook {
+			return refArea{}, false
+		}
+		area.sheet = n.scope
+	}
+	return area, true
+}
+
+// definedNames returns the workbook's defined names in the order it declares
+// them, with sample values from the scanned rows of their sheets when
+// samples is set.
+func (i *Inspector) definedNames(ctx context.Context, samples bool) ([]DefinedName, error) {
+	if len(i.wb.names) == 0 {
+		return nil, nil
+	}
+	names := make([]DefinedName, 0, len(i.wb.names))
+	for _, n := range i.wb.names {
+		dn := DefinedName{
+			Name:     n.name,
+			Scope:    n.scope,
+			RefersTo: n.refersTo,
+			Hidden:   n.hidden,
+		}
+		if area, ok := n.area(); ok {
+			dn.Range = quoteSheetName(area.sheet) + "!" + area.a1()
+			if _, exists := i.wb.sheet(area.sheet); samples && exists {
+				data, err := i.sheetData(ctx, area.sheet)
+				if err != nil {
+					return nil, err
+				}
+				dn.SampleValues = area.values(data.rows, i.config.maxSamples)
+			}
+		}
+		names = append(names, dn)
+	}
+	return names, nil
+}
+
+// values returns up to limit non-empty values of the area's cells among rows,
+// row by row.
+func (a refArea) values(rows [][]string, limit int) []string {
+	top, bottom := a.top, min(a.bottom, len(rows))
+	if a.wholeCols {
+		top, bottom = 1, len(rows)
+	}
+	var out []string
+	for r := max(top, 1); r <= bottom && len(out) < limit; r++ {
+		row := rows[r-1]
+		left, right := a.left, min(a.right, len(row)-1)
+		if a.wholeRows {
+			left, right = 0, len(row)-1
+		}
+		for c := left; c <= right && len(out) < limit; c++ {
+			if row[c] != "" {
+				out = append(out, row[c])
+			}
+		}
+	}
+	return out
+}
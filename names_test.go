@@ -0,0 +1,60 @@
+package excelinspect
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefinedNames(t *testing.T) {
+	stock := xrow(1, 0, "NAME", "QTY", "PRICE") +
+		xrow(2, 0, "Bolt", "10", "1.5") +
+		xrow(3, 0, "Nut", "20", "0.5") +
+		xrow(4, 0, "Screw", "30", "0.25") +
+		xrow(5, 0, "Washer", "40", "0.1") +
+		xrow(6, 0, "Rivet", "50", "0.3") +
+		xrow(7, 0, "Pin", "60", "0.2")
+	rates := xrow(1, 0, "VAT", "0.11")
+	names := `<definedName name="Items">'Stock Data'!$A$2:$A$5</definedName>` +
+		`<definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">'Stock Data'!$A$1:$C$7</definedName>` +
+		`<definedName name="Rate" localSheetId="1">Rates!$B$1</definedName>` +
+		`<definedName name="Here" localSheetId="1">$A$1</definedName>` +
+		`<definedName name="Quantities">'Stock Data'!$B:$B</definedName>` +
+		`<definedName name="Tax">0.1</definedName>`
+	data := xlsxFile(t, []testSheet{{name: "Stock Data", rows: stock}, {name: "Rates", rows: rates}}, names, nil)
+
+	want := []DefinedName{
+		{Name: "Items", Scope: ScopeWorkbook, RefersTo: "'Stock Data'!$A$2:$A$5", Range: "'Stock Data'!A2:A5",
+			SampleValues: []string{"Bolt", "Nut", "Screw", "Washer"}},
+		{Name: "_xlnm._FilterDatabase", Scope: "Stock Data", RefersTo: "'Stock Data'!$A$1:$C$7", Range: "'Stock Data'!A1:C7", Hidden: true,
+			SampleValues: []string{"NAME", "QTY", "PRICE", "Bolt", "10"}},
+		{Name: "Rate", Scope: "Rates", RefersTo: "Rates!$B$1", Range: "Rates!B1",
+			SampleValues: []string{"0.11"}},
+		// A reference without a sheet belongs to the name's sheet.
+		{Name: "Here", Scope: "Rates", RefersTo: "$A$1", Range: "Rates!A1",
+			SampleValues: []string{"VAT"}},
+		{Name: "Quantities", Scope: ScopeWorkbook, RefersTo: "'Stock Data'!$B:$B", Range: "'Stock Data'!B:B",
+			SampleValues: []string{"QTY", "10", "20", "30", "40"}},
+		{Name: "Tax", Scope: ScopeWorkbook, RefersTo: "0.1"},
+	}
+
+	ins := openTestWorkbook(t, data)
+	info, err := ins.InspectWithDetails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info.DefinedNames, want) {
+		t.Errorf("defined names:\n got %+v\nwant %+v", info.DefinedNames, want)
+	}
+
+	// Inspect lists the same names without reading any sheet for samples.
+	info, err = openTestWorkbook(t, data).Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx := range want {
+		want[idx].SampleValues = nil
+	}
+	if !reflect.DeepEqual(info.DefinedNames, want) {
+		t.Errorf("defined names without details:\n got %+v\nwant %+v", info.DefinedNames, want)
+	}
+}
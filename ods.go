@@ -0,0 +1,599 @@
+package excelinspect
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// odsMimeType starts the mimetype entry of OpenDocument spreadsheets and
+// their templates.
+const odsMimeType = "application/vnd.oasis.opendocument.spreadsheet"
+
+// odsContent is the content.xml part of an .ods file, which holds every
+// table. The offsets of the workbook's sheets point into its uncompressed
+// bytes.
+type odsContent struct {
+	file *zip.File
+	// header lists the cell styles with bold text or a bottom border.
+	header map[string]bool
+}
+
+// odsStyle is the part of a <style:style> the inspector uses.
+type odsStyle struct {
+	Name   string `xml:"name,attr"`
+	Family string `xml:"family,attr"`
+	Parent string `xml:"parent-style-name,attr"`
+	Text   struct {
+		FontWeight string `xml:"font-weight,attr"`
+	} `xml:"text-properties"`
+	Cell struct {
+		Border       string `xml:"border,attr"`
+		BorderBottom string `xml:"border-bottom,attr"`
+	} `xml:"table-cell-properties"`
+	Table struct {
+		Display string `xml:"display,attr"`
+	} `xml:"table-properties"`
+}
+
+// isODS reports whether archive is an OpenDocument spreadsheet rather than
+// an .xlsx package.
+func isODS(archive *zip.Reader) bool {
+	for _, f := range archive.File {
+		if f.Name != "mimetype" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return false
+		}
+		defer rc.Close()
+		head := make([]byte, len(odsMimeType))
+		_, err = io.ReadFull(rc, head)
+		return err == nil && string(head) == odsMimeType
+	}
+	return false
+}
+
+// readODS reads the table list and cell styles of an .ods file. Each table
+// is located by the offset of its <table:table> element in content.xml, so
+// opening a sheet skips the earlier tables without parsing them.
+func readODS(archive *zip.Reader) (*workbook, error) {
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	content := files["content.xml"]
+	if content == nil {
+		return nil, errors.New("no content.xml in OpenDocument file")
+	}
+
+	styles := make(map[string]odsStyle)
+	var named struct {
+		Styles []odsStyle `xml:"styles>style"`
+	}
+	if err := readZipXML(files["styles.xml"], &named); err == nil {
+		for _, s := range named.Styles {
+			styles[s.Name] = s
+		}
+	}
+
+	rc, err := content.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	wb := &workbook{epoch: excelEpoch}
+	decoder := xml.NewDecoder(bufio.NewReader(rc))
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content.xml: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "automatic-styles":
+			var auto struct {
+				Styles []odsStyle `xml:"style"`
+			}
+			if err := decoder.DecodeElement(&auto, &start); err != nil {
+				return nil, fmt.Errorf("failed to read content.xml: %w", err)
+			}
+			for _, s := range auto.Styles {
+				styles[s.Name] = s
+			}
+		case "table":
+			sheet := workbookSheet{name: attrValue(start, "name"), offset: int(offset)}
+			if styles[attrValue(start, "style-name")].Table.Display == "false" {
+				sheet.state = "hidden"
+			}
+			wb.sheets = append(wb.sheets, sheet)
+			if err := decoder.Skip(); err != nil {
+				return nil, fmt.Errorf("failed to read content.xml: %w", err)
+			}
+		case "named-expressions":
+			// Names declared inside a table, scoped to it, are skipped along
+			// with the table.
+			var names struct {
+				Ranges []struct {
+					Name    string `xml:"name,attr"`
+					Address string `xml:"cell-range-address,attr"`
+				} `xml:"named-range"`
+				Expressions []struct {
+					Name       string `xml:"name,attr"`
+					Expression string `xml:"expression,attr"`
+				} `xml:"named-expression"`
+			}
+			if err := decoder.DecodeElement(&names, &start); err != nil {
+				return nil, fmt.Errorf("failed to read content.xml: %w", err)
+			}
+			for _, r := range names.Ranges {
+				wb.names = append(wb.names, newODSName(r.Name, r.Address))
+			}
+			for _, e := range names.Expressions {
+				wb.names = append(wb.names, workbookName{name: e.Name, scope: ScopeWorkbook, refersTo: e.Expression})
+			}
+		case "document-content", "body", "spreadsheet":
+		default:
+			if err := decoder.Skip(); err != nil {
+				return nil, fmt.Errorf("failed to read content.xml: %w", err)
+			}
+		}
+	}
+
+	wb.ods = &odsContent{file: content, header: make(map[string]bool)}
+	for name, s := range styles {
+		if s.Family == "table-cell" && odsHeaderStyle(styles, name) {
+			wb.ods.header[name] = true
+		}
+	}
+	return wb, nil
+}
+
+// odsHeaderStyle reports whether cell style name, or a style it inherits
+// from, has bold text or a bottom border.
+func odsHeaderStyle(styles map[string]odsStyle, name string) bool {
+	for depth := 0; name != "" && depth < 16; depth++ {
+		s, ok := styles[name]
+		if !ok {
+			return false
+		}
+		switch s.Text.FontWeight {
+		case "bold", "600", "700", "800", "900":
+			return true
+		}
+		for _, border := range []string{s.Cell.BorderBottom, s.Cell.Border} {
+			if border != "" && border != "none" && !strings.HasPrefix(border, "0pt") {
+				return true
+			}
+		}
+		name = s.Parent
+	}
+	return false
+}
+
+// odsSheetReader streams the rows of one table of content.xml. Rows and
+// cells repeated with number-rows-repeated / number-columns-repeated are
+// expanded, except runs of empty ones, which only move the position on.
+// Covered cells (those under a merge) take up columns but hold no value.
+type odsSheetReader struct {
+	wb         *workbook
+	rc         io.ReadCloser
+	decoder    *xml.Decoder
+	inTable    bool
+	rows       int // row elements read, counting repeats
+	last       int
+	repeat     sheetRow
+	repeats    int
+	colStyles  []odsColumnStyle
+	merges     []mergeRange
+	hiddenRows []lineSpan
+	hiddenCols []lineSpan
+}
+
+// odsColumnStyle is the default cell style of a run of columns.
+type odsColumnStyle struct {
+	first, last int
+	style       string
+}
+
+func (wb *workbook) openODSSheet(sheet workbookSheet) (*odsSheetReader, error) {
+	r := &odsSheetReader{wb: wb}
+	rc, err := wb.ods.file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sheet %q: %w", sheet.name, err)
+	}
+	if _, err := io.CopyN(io.Discard, rc, int64(sheet.offset)); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to open sheet %q: %w", sheet.name, err)
+	}
+	r.rc = rc
+	// Namespace prefixes declared on the root element are unknown past the
+	// offset; element names are matched on their local part.
+	r.decoder = xml.NewDecoder(bufio.NewReader(rc))
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			r.close()
+			return nil, fmt.Errorf("failed to open sheet %q: %w", sheet.name, err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "table" {
+			r.inTable = true
+			return r, nil
+		}
+	}
+}
+
+// next returns the next row that has a value; empty rows are skipped.
+func (r *odsSheetReader) next() (sheetRow, bool, error) {
+	if r.repeats > 0 {
+		r.repeats--
+		r.repeat.Number++
+		r.last = r.repeat.Number
+		return r.copyRow(r.repeat), true, nil
+	}
+	for r.inTable {
+		token, err := r.decoder.Token()
+		if err != nil {
+			r.inTable = false
+			return sheetRow{}, false, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table-column":
+				r.addColumnStyle(t)
+				if err := r.decoder.Skip(); err != nil {
+					return sheetRow{}, false, err
+				}
+			case "table-row":
+				row, count, err := r.readRow(t)
+				if err != nil {
+					return sheetRow{}, false, err
+				}
+				if odsHidden(t) {
+					r.hiddenRows = addSpan(r.hiddenRows, r.rows+1, r.rows+count)
+				}
+				r.rows += count
+				// Only rows without a value or formula are skipped; a row of
+				// formulas whose results were not saved still counts.
+				if row.Values == nil && row.formulas == nil {
+					continue
+				}
+				if count > 1 {
+					r.repeat, r.repeats = row, count-1
+				}
+				r.last = row.Number
+				return row, true, nil
+			case "table-header-rows", "table-row-group", "table-rows",
+				"table-header-columns", "table-column-group", "table-columns":
+				// Groups only wrap rows and columns.
+			default:
+				if err := r.decoder.Skip(); err != nil {
+					return sheetRow{}, false, err
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "table" {
+				r.inTable = false
+			}
+		}
+	}
+	return sheetRow{}, false, nil
+}
+
+// copyRow returns a copy of row that does not share its slices, so that
+// callers keeping one repeated row do not see changes to another.
+func (r *odsSheetReader) copyRow(row sheetRow) sheetRow {
+	row.Values = append([]string(nil), row.Values...)
+	if row.formats != nil {
+		row.formats = append([]formatKind(nil), row.formats...)
+	}
+	if row.marks != nil {
+		row.marks = append([]cellMark(nil), row.marks...)
+	}
+	if row.formulas != nil {
+		row.formulas = append([]*formula(nil), row.formulas...)
+	}
+	return row
+}
+
+func (r *odsSheetReader) addColumnStyle(start xml.StartElement) {
+	first := 0
+	if n := len(r.colStyles); n > 0 {
+		first = r.colStyles[n-1].last + 1
+	}
+	count := odsRepeat(start, "number-columns-repeated")
+	if odsHidden(start) {
+		r.hiddenCols = addSpan(r.hiddenCols, first, first+count-1)
+	}
+	r.colStyles = append(r.colStyles, odsColumnStyle{
+		first: first,
+		last:  first + count - 1,
+		style: attrValue(start, "default-cell-style-name"),
+	})
+}
+
+// columnStyle returns the default cell style of column col.
+func (r *odsSheetReader) columnStyle(col int) string {
+	for _, c := range r.colStyles {
+		if col >= c.first && col <= c.last {
+			return c.style
+		}
+	}
+	return ""
+}
+
+// readRow decodes the row element just opened and returns it with the
+// number of times it repeats.
+func (r *odsSheetReader) readRow(start xml.StartElement) (sheetRow, int, error) {
+	count := odsRepeat(start, "number-rows-repeated")
+	rowStyle := attrValue(start, "default-cell-style-name")
+	row := sheetRow{Number: r.rows + 1}
+	col := 0
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return row, count, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table-cell":
+				n, err := r.readCell(t, col, rowStyle, &row)
+				if err != nil {
+					return row, count, err
+				}
+				col += n
+			case "covered-table-cell":
+				col += odsRepeat(t, "number-columns-repeated")
+				if err := r.decoder.Skip(); err != nil {
+					return row, count, err
+				}
+			default:
+				if err := r.decoder.Skip(); err != nil {
+					return row, count, err
+				}
+			}
+		case xml.EndElement:
+			return row, count, nil
+		}
+	}
+}
+
+// readCell decodes the cell element just opened at column col into row and
+// returns the number of columns it takes up. A cell without a style of its
+// own uses rowStyle, then its column's default style.
+func (r *odsSheetReader) readCell(start xml.StartElement, col int, rowStyle string, row *sheetRow) (int, error) {
+	count := odsRepeat(start, "number-columns-repeated")
+	var valueType, value string
+	style := rowStyle
+	hasValue, isError := false, false
+	attrs := make(map[string]string, len(start.Attr))
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "value-type":
+			if strings.Contains(attr.Name.Space, "calcext") {
+				isError = attr.Value == "error"
+			} else {
+				valueType = attr.Value
+			}
+		case "style-name":
+			style = attr.Value
+		default:
+			attrs[attr.Name.Local] = attr.Value
+		}
+	}
+	text, err := readODSCellText(r.decoder)
+	if err != nil {
+		return count, err
+	}
+
+	kind := formatGeneral
+	switch valueType {
+	case "float", "percentage", "currency":
+		value, hasValue = attrs["value"], true
+		if value == "" {
+			value = text
+		}
+		switch valueType {
+		case "percentage":
+			kind = formatPercent
+		case "currency":
+			kind = formatCurrency
+		}
+	case "date":
+		value, kind = odsDate(attrs["date-value"])
+		hasValue = true
+	case "time":
+		value, kind = odsTime(attrs["time-value"]), formatTime
+		hasValue = true
+	case "boolean":
+		value, kind = "0", formatBoolean
+		if attrs["boolean-value"] == "true" {
+			value = "1"
+		}
+		hasValue = true
+	case "string":
+		value, hasValue = text, true
+		if v, ok := attrs["string-value"]; ok {
+			value = v
+		}
+	}
+	if isError {
+		value, kind, hasValue = text, formatError, true
+	}
+
+	if cols, rows := odsRepeat(start, "number-columns-spanned"), odsRepeat(start, "number-rows-spanned"); cols > 1 || rows > 1 {
+		top := row.Number - 1
+		r.merges = append(r.merges, mergeRange{top: top, left: col, bottom: top + rows - 1, right: col + cols - 1})
+	}
+	src, hasFormula := attrs["formula"]
+	if !hasValue && !hasFormula {
+		// Runs of empty cells, often thousands long, only move on.
+		return count, nil
+	}
+	for idx := 0; idx < count; idx++ {
+		cellStyle := style
+		if cellStyle == "" {
+			cellStyle = r.columnStyle(col + idx)
+		}
+		row.setCell(col+idx, value, hasValue, kind, r.wb.ods.header[cellStyle])
+		if hasFormula {
+			row.setFormula(col+idx, parseODSFormula(src, row.Number, col+idx))
+		}
+	}
+	return count, nil
+}
+
+// odsRepeat returns the positive integer attribute name of start, or 1.
+func odsRepeat(start xml.StartElement, name string) int {
+	n, err := strconv.Atoi(attrValue(start, name))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// odsHidden reports whether a row or column element is hidden: collapsed,
+// or filtered out by an autofilter.
+func odsHidden(start xml.StartElement) bool {
+	v := attrValue(start, "visibility")
+	return v == "collapse" || v == "filter"
+}
+
+// readODSCellText returns the text of the cell element just opened,
+// consuming it: paragraphs joined by line breaks, with <text:s>, <text:tab>
+// and <text:line-break> expanded. Annotations are left out.
+func readODSCellText(decoder *xml.Decoder) (string, error) {
+	var b strings.Builder
+	depth, paragraphs := 0, 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "annotation":
+				if err := decoder.Skip(); err != nil {
+					return "", err
+				}
+				continue
+			case "p", "h":
+				if depth == 0 {
+					if paragraphs > 0 {
+						b.WriteByte('\n')
+					}
+					paragraphs++
+				}
+			case "s":
+				b.WriteString(strings.Repeat(" ", odsRepeat(t, "c")))
+			case "tab":
+				b.WriteByte('\t')
+			case "line-break":
+				b.WriteByte('\n')
+			}
+			depth++
+		case xml.EndElement:
+			if depth == 0 {
+				return b.String(), nil
+			}
+			depth--
+		case xml.CharData:
+			if depth > 0 {
+				b.Write(t)
+			}
+		}
+	}
+}
+
+// odsDate converts an office:date-value to the text date-formatted .xlsx
+// cells get: "2006-01-02" for whole days and RFC3339 otherwise.
+func odsDate(v string) (string, formatKind) {
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02"} {
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			continue
+		}
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+			return t.Format("2006-01-02"), formatDate
+		}
+		return t.Format(time.RFC3339), formatDateTime
+	}
+	return v, formatGeneral
+}
+
+// odsTime converts an office:time-value duration such as PT13H30M00S to the
+// RFC3339 time on Excel's zero date that time-formatted .xlsx cells get.
+func odsTime(v string) string {
+	s, ok := strings.CutPrefix(v, "P")
+	if !ok {
+		return v
+	}
+	var d time.Duration
+	if days, rest, ok := strings.Cut(s, "D"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return v
+		}
+		d, s = time.Duration(n)*24*time.Hour, rest
+	}
+	if s = strings.TrimPrefix(s, "T"); s != "" {
+		part, err := time.ParseDuration(strings.ToLower(s))
+		if err != nil {
+			return v
+		}
+		d += part
+	}
+	return excelEpoch.Add(d.Round(time.Second)).Format(time.RFC3339)
+}
+
+// finish reads the rest of the table, counting its rows and collecting its
+// merged ranges, then closes the part. It stops with ctx's error once ctx is
+// done.
+func (r *odsSheetReader) finish(ctx context.Context) error {
+	defer r.close()
+	for n := 0; ; n++ {
+		if n%1024 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		_, ok, err := r.next()
+		if err != nil || !ok {
+			return err
+		}
+	}
+}
+
+// dimensionRows is never known for .ods: tables declare no used range.
+func (r *odsSheetReader) dimensionRows() (int, bool) { return 0, false }
+
+func (r *odsSheetReader) lastRow() int { return r.last }
+
+func (r *odsSheetReader) mergeRanges() []mergeRange { return r.merges }
+
+func (r *odsSheetReader) hiddenLines() (rows, cols []lineSpan) {
+	return r.hiddenRows, r.hiddenCols
+}
+
+func (r *odsSheetReader) close() {
+	if r.rc != nil {
+		r.rc.Close()
+		r.rc = nil
+	}
+}
@@ -0,0 +1,86 @@
+package excelinspect
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+// odsFile returns an .ods package whose content.xml body holds tables.
+func odsFile(t *testing.T, tables string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, part := range []struct{ name, data string }{
+		{"mimetype", odsMimeType},
+		{"content.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" office:version="1.2"><office:body><office:spreadsheet>` + tables + `</office:spreadsheet></office:body></office:document-content>`},
+	} {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(part.data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadODS(t *testing.T) {
+	data := odsFile(t, `<table:table table:name="Data">
+<table:table-column table:number-columns-repeated="4"/>
+<table:table-row><table:table-cell office:value-type="string" table:number-columns-spanned="2"><text:p>Title</text:p></table:table-cell><table:covered-table-cell/><table:table-cell office:value-type="string"><text:p>C</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="2"><table:table-cell office:value-type="float" office:value="5" table:number-columns-repeated="3"><text:p>5</text:p></table:table-cell></table:table-row>
+<table:table-row><table:table-cell table:number-columns-spanned="2" table:number-rows-spanned="2" office:value-type="string"><text:p>Tall</text:p></table:table-cell><table:covered-table-cell/><table:table-cell office:value-type="percentage" office:value="0.25"><text:p>25%</text:p></table:table-cell></table:table-row>
+<table:table-row><table:covered-table-cell table:number-columns-repeated="2"/><table:table-cell office:value-type="boolean" office:boolean-value="true"><text:p>TRUE</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="1000"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+<table:table-row><table:table-cell table:formula="of:=[.A2]*2"/></table:table-row>
+<table:table-row table:number-rows-repeated="1048000"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+</table:table>`)
+	ins, err := NewFromBytes(data, WithMaxSampleRows(2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	d, err := ins.sheetData(context.Background(), "Data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		row  int
+		want []string
+	}{
+		{1, []string{"Title", "", "C"}},
+		{2, []string{"5", "5", "5"}},
+		{3, []string{"5", "5", "5"}},
+		{4, []string{"Tall", "", "0.25"}},
+		{5, []string{"", "", "1"}},
+		{6, nil},
+		{1006, nil},
+	}
+	for _, tt := range tests {
+		if got := valueAt(d.rows, tt.row-1); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("row %d = %q, want %q", tt.row, got, tt.want)
+		}
+	}
+	// The row of a formula without a saved result is kept; the trailing
+	// run of empty rows is not.
+	if len(d.rows) != 1006 || d.rowCount() != 1006 {
+		t.Errorf("rows = %d, row count = %d, want 1006", len(d.rows), d.rowCount())
+	}
+	if f := valueAt(valueAt(d.formulas, 1005), 0); f == nil || f.text != "=R[-1004]C*2" {
+		t.Errorf("formula of A1006 = %+v, want =R[-1004]C*2", f)
+	}
+	wantMerges := []mergeRange{
+		{top: 0, left: 0, bottom: 0, right: 1},
+		{top: 3, left: 0, bottom: 4, right: 1},
+	}
+	if !reflect.DeepEqual(d.merges, wantMerges) {
+		t.Errorf("merges = %+v, want %+v", d.merges, wantMerges)
+	}
+}
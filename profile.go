@@ -0,0 +1,181 @@
+package excelinspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HeaderDictionary lists the cell values that identify a column header. A row
+// is taken as a header when it has at least MinCells non-empty cells and at
+// least MinMatches of them are dictionary tokens. Tokens match whole cell
+// values, case-insensitively. MinCells defaults to 3 and MinMatches to 1;
+// MinCells is never below MinMatches.
+type HeaderDictionary struct {
+	Tokens     []string `json:"tokens" yaml:"tokens"`
+	MinCells   int      `json:"min_cells,omitempty" yaml:"min_cells,omitempty"`
+	MinMatches int      `json:"min_matches,omitempty" yaml:"min_matches,omitempty"`
+}
+
+// defaultMinHeaderCells is HeaderDictionary.MinCells when a profile leaves
+// it unset.
+const defaultMinHeaderCells = 3
+
+// TokenRule matches a set of values when every AllOf token and at least one
+// AnyOf token is present. An empty rule never matches.
+type TokenRule struct {
+	AllOf []string `json:"all_of,omitempty" yaml:"all_of,omitempty"`
+	AnyOf []string `json:"any_of,omitempty" yaml:"any_of,omitempty"`
+}
+
+// DetectionProfile is the vocabulary used to find headers and sections:
+//
+//   - Headers decides whether a row looks like a column header.
+//   - ReportHeader marks rows that start a report block; it is matched against
+//     whole cell values. When any row matches, blocks are split on those rows
+//     instead of on Headers.
+//   - SectionMarkers are substrings that mark a row as a title or marker row
+//     rather than data.
+//   - TitleMarkers are substrings that, when found in the row above a header,
+//     anchor the section title on that cell.
+//   - MergeSections is matched against section titles as substrings; matching
+//     sections with identical headers are merged into one.
+type DetectionProfile struct {
+	Name           string           `json:"name" yaml:"name"`
+	Headers        HeaderDictionary `json:"headers" yaml:"headers"`
+	ReportHeader   TokenRule        `json:"report_header,omitempty" yaml:"report_header,omitempty"`
+	SectionMarkers []string         `json:"section_markers,omitempty" yaml:"section_markers,omitempty"`
+	TitleMarkers   []string         `json:"title_markers,omitempty" yaml:"title_markers,omitempty"`
+	MergeSections  TokenRule        `json:"merge_sections,omitempty" yaml:"merge_sections,omitempty"`
+}
+
+// VehicleInventoryProfile returns the built-in profile for the vehicle
+// inventory reports this package was first written against. It is the default
+// when no profile is set.
+func VehicleInventoryProfile() DetectionProfile {
+	return DetectionProfile{
+		Name: "vehicle inventory",
+		Headers: HeaderDictionary{
+			Tokens: []string{
+				"MERK", "TYPE", "TRANSMITION", "TRANSMISSION", "YEAR", "COLOR", "ODOMETER", "STNK",
+				"PURCHASE DATE", "AGING", "CREDIT PRICE", "CASH PRICE", "SELLING PRICE", "MARKET PRICE",
+				"TOTAL NILAI STOCK (EST.)", "TOTAL NILAI STOCK (ACT.)", "NOTES DOCUMENT", "MR2",
+				"NO", "STATUS", "PLATE NO", "UNIT CATEGORY",
+			},
+			MinCells:   defaultMinHeaderCells,
+			MinMatches: 2,
+		},
+		ReportHeader: TokenRule{
+			AllOf: []string{"MERK", "TYPE"},
+			AnyOf: []string{"TRANSMITION", "TRANSMISSION", "YEAR", "ODOMETER", "STNK", "PURCHASE DATE"},
+		},
+		SectionMarkers: []string{"CROSS SELLING", "NON CROSS SELLING", "LAST UPDATE", "HANDOVER"},
+		TitleMarkers:   []string{"CROSS SELLING", "NON CROSS SELLING"},
+		MergeSections: TokenRule{
+			AllOf: []string{"HANDOVER"},
+			AnyOf: []string{"CROSS SELLING", "NON CROSS SELLING"},
+		},
+	}
+}
+
+// LoadDetectionProfile reads a DetectionProfile from a JSON or YAML file. The
+// format is chosen by extension: .yaml and .yml are YAML, anything else JSON.
+func LoadDetectionProfile(path string) (DetectionProfile, error) {
+	var p DetectionProfile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, fmt.Errorf("failed to read detection profile: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &p)
+	default:
+		err = json.Unmarshal(data, &p)
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to parse detection profile %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// WithDetectionProfile replaces the vocabulary used for header and section
+// detection.
+func WithDetectionProfile(p DetectionProfile) InspectorOption {
+	return func(i *Inspector) {
+		i.detector = newDetector(p)
+	}
+}
+
+// detector is a DetectionProfile with its tokens normalized for matching.
+type detector struct {
+	headerTokens   map[string]bool
+	minCells       int
+	minMatches     int
+	reportAllOf    []string
+	reportAnyOf    []string
+	sectionMarkers []string
+	titleMarkers   []string
+	mergeAllOf     []string
+	mergeAnyOf     []string
+}
+
+func newDetector(p DetectionProfile) *detector {
+	d := &detector{
+		headerTokens:   make(map[string]bool, len(p.Headers.Tokens)),
+		minCells:       p.Headers.MinCells,
+		minMatches:     p.Headers.MinMatches,
+		reportAllOf:    normalizeTokens(p.ReportHeader.AllOf),
+		reportAnyOf:    normalizeTokens(p.ReportHeader.AnyOf),
+		sectionMarkers: normalizeTokens(p.SectionMarkers),
+		titleMarkers:   normalizeTokens(p.TitleMarkers),
+		mergeAllOf:     normalizeTokens(p.MergeSections.AllOf),
+		mergeAnyOf:     normalizeTokens(p.MergeSections.AnyOf),
+	}
+	for _, t := range normalizeTokens(p.Headers.Tokens) {
+		d.headerTokens[t] = true
+	}
+	if d.minCells <= 0 {
+		d.minCells = defaultMinHeaderCells
+	}
+	if d.minMatches <= 0 {
+		d.minMatches = 1
+	}
+	d.minCells = max(d.minCells, d.minMatches)
+	return d
+}
+
+func normalizeTokens(tokens []string) []string {
+	out := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		if t = strings.ToUpper(strings.TrimSpace(t)); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// matchTokenRule reports whether match accepts every allOf token and at least
+// one anyOf token. A rule with no tokens never matches.
+func matchTokenRule(allOf, anyOf []string, match func(string) bool) bool {
+	if len(allOf) == 0 && len(anyOf) == 0 {
+		return false
+	}
+	for _, t := range allOf {
+		if !match(t) {
+			return false
+		}
+	}
+	if len(anyOf) == 0 {
+		return true
+	}
+	for _, t := range anyOf {
+		if match(t) {
+			return true
+		}
+	}
+	return false
+}
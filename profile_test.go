@@ -0,0 +1,27 @@
+package excelinspect
+
+import "testing"
+
+func TestDetectorThresholds(t *testing.T) {
+	tests := []struct {
+		name           string
+		headers        HeaderDictionary
+		wantMinCells   int
+		wantMinMatches int
+	}{
+		{"unset", HeaderDictionary{}, 3, 1},
+		{"built-in", VehicleInventoryProfile().Headers, 3, 2},
+		{"min cells only", HeaderDictionary{MinCells: 5}, 5, 1},
+		{"min matches above default", HeaderDictionary{MinMatches: 4}, 4, 4},
+		{"min cells below min matches", HeaderDictionary{MinCells: 2, MinMatches: 3}, 3, 3},
+		{"one cell", HeaderDictionary{MinCells: 1}, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDetector(DetectionProfile{Headers: tt.headers})
+			if d.minCells != tt.wantMinCells || d.minMatches != tt.wantMinMatches {
+				t.Errorf("min cells %d, min matches %d, want %d, %d", d.minCells, d.minMatches, tt.wantMinCells, tt.wantMinMatches)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package excelinspect
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	toon "github.com/mateuszkardas/toon-go"
+)
+
+// RenderOptions controls WriteMarkdown and WriteTOON.
+type RenderOptions struct {
+	// Detailed renders SheetDetails: column and section tables in Markdown,
+	// the compact sheet, section and column tables in TOON.
+	Detailed bool
+	// Sample limits TOON column values to ColumnInfo.SampleValues instead of
+	// every scanned value, as InspectWithDetailsTOONSample does. Markdown
+	// ignores it.
+	Sample bool
+}
+
+// WriteMarkdown renders info as Markdown to w, streaming each sheet and
+// section as it is rendered. Section tables take their rows from the
+// Inspector's read of each sheet, so the Inspector that produced info must
+// still be open.
+func (i *Inspector) WriteMarkdown(w io.Writer, info *FileInfo, opts RenderOptions) error {
+	return i.WriteMarkdownContext(context.Background(), w, info, opts)
+}
+
+func (i *Inspector) WriteMarkdownContext(ctx context.Context, w io.Writer, info *FileInfo, opts RenderOptions) error {
+	ctx, cancel := i.timeoutContext(ctx)
+	defer cancel()
+	return i.writeMarkdown(ctx, w, info, opts.Detailed)
+}
+
+// WriteTOON renders info as TOON to w, one top-level table at a time. Unless
+// opts.Sample is set, detailed output takes every scanned column value from
+// the Inspector's read of each sheet, so the Inspector that produced info
+// must still be open.
+func (i *Inspector) WriteTOON(w io.Writer, info *FileInfo, opts RenderOptions) error {
+	return i.WriteTOONContext(context.Background(), w, info, opts)
+}
+
+func (i *Inspector) WriteTOONContext(ctx context.Context, w io.Writer, info *FileInfo, opts RenderOptions) error {
+	ctx, cancel := i.timeoutContext(ctx)
+	defer cancel()
+	return i.writeTOON(ctx, w, info, opts)
+}
+
+// toonPayloadKeys is the order the compact TOON tables are written in.
+var toonPayloadKeys = []string{"sheet_details", "skipped_sheets", "defined_names", "sections", "columns", "profiles", "formulas", "dependencies"}
+
+func (i *Inspector) writeTOON(ctx context.Context, w io.Writer, info *FileInfo, opts RenderOptions) error {
+	b := newRenderWriter(w)
+	if !opts.Detailed {
+		out, err := toon.Marshal(&FileInfo{Sheets: info.Sheets, SkippedSheets: info.SkippedSheets, DefinedNames: info.DefinedNames}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to marshal toon: %w", err)
+		}
+		b.WriteString(out)
+		return b.flush()
+	}
+
+	var payload map[string]interface{}
+	if opts.Sample {
+		payload = buildCompactTOONPayloadSample(info, i.config.maxSamples)
+	} else {
+		var err error
+		payload, err = i.buildCompactTOONPayloadFull(ctx, info)
+		if err != nil {
+			return err
+		}
+	}
+	first := true
+	for _, key := range toonPayloadKeys {
+		v, ok := payload[key]
+		if !ok {
+			continue
+		}
+		out, err := toon.Marshal(map[string]interface{}{key: v}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to marshal toon %s: %w", key, err)
+		}
+		if !first {
+			b.WriteString("\n")
+		}
+		first = false
+		b.WriteString(out)
+		if err := b.flush(); err != nil {
+			return err
+		}
+	}
+	return b.flush()
+}
+
+// renderWriter buffers rendered output and keeps the first write error, so
+// renderers can write freely and check once per flush.
+type renderWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func newRenderWriter(w io.Writer) *renderWriter {
+	return &renderWriter{w: bufio.NewWriter(w)}
+}
+
+func (r *renderWriter) WriteString(s string) {
+	if r.err != nil {
+		return
+	}
+	_, r.err = r.w.WriteString(s)
+}
+
+func (r *renderWriter) flush() error {
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	if r.err != nil {
+		return fmt.Errorf("failed to write output: %w", r.err)
+	}
+	return nil
+}
@@ -0,0 +1,765 @@
+package excelinspect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cellMark flags what a worksheet cell carried besides its value.
+type cellMark uint8
+
+const (
+	// markHeaderStyle is set on cells whose style is bold or has a bottom
+	// border.
+	markHeaderStyle cellMark = 1 << iota
+	// markBlank is set on cells holding only whitespace, which read as "".
+	markBlank
+)
+
+// sheetRow is one worksheet row with every cell placed at its real column
+// index. Number is the 1-based worksheet row number, so rows that the file
+// omits (because they are empty) leave gaps instead of shifting later rows up.
+// Values are trimmed. formats, marks and formulas are nil when no cell has a
+// non-General format, a mark or a formula.
+type sheetRow struct {
+	Number   int
+	Values   []string
+	formats  []formatKind
+	marks    []cellMark
+	formulas []*formula
+}
+
+// setCell stores the cell at col: its value, when it has one, trimmed (a
+// whitespace-only value is marked blank), its format unless General, and
+// whether it has header styling.
+func (row *sheetRow) setCell(col int, value string, hasValue bool, kind formatKind, header bool) {
+	var mark cellMark
+	if header {
+		mark |= markHeaderStyle
+	}
+	if hasValue {
+		trimmed := strings.TrimSpace(value)
+		if trimmed == "" && value != "" {
+			mark |= markBlank
+		}
+		row.Values = setAt(row.Values, col, trimmed)
+	}
+	if kind != formatGeneral {
+		row.formats = setAt(row.formats, col, kind)
+	}
+	if mark != 0 {
+		row.marks = setAt(row.marks, col, mark)
+	}
+}
+
+// setFormula records that the cell at col is computed by f.
+func (row *sheetRow) setFormula(col int, f *formula) {
+	row.formulas = setAt(row.formulas, col, f)
+}
+
+// sheetReader reads one worksheet row by row, whatever the file format.
+type sheetReader interface {
+	// next returns the next row; ok is false once the rows are exhausted.
+	next() (row sheetRow, ok bool, err error)
+	// dimensionRows returns the last row the sheet declares, if usable.
+	dimensionRows() (int, bool)
+	// finish reads past the remaining rows, counting them and collecting
+	// the merged ranges, then releases the reader.
+	finish(ctx context.Context) error
+	// lastRow returns the number of the last row read or counted.
+	lastRow() int
+	mergeRanges() []mergeRange
+	// hiddenLines returns the hidden rows and columns met so far, all of
+	// them once finish has run.
+	hiddenLines() (rows, cols []lineSpan)
+	close()
+}
+
+// openSheet opens the named worksheet for reading. A sheet without cells of
+// its own, such as a chart sheet, reads as having no rows.
+func (i *Inspector) openSheet(sheetName string) (sheetReader, error) {
+	if i.wb.text != nil {
+		return i.wb.text.openSheet(), nil
+	}
+	sheet, _ := i.wb.sheet(sheetName)
+	if i.wb.biff != nil {
+		return i.wb.openXLSSheet(sheet)
+	}
+	if i.wb.ods != nil {
+		return i.wb.openODSSheet(sheet)
+	}
+	return i.wb.openXLSXSheet(sheet)
+}
+
+// xlsxSheetReader streams one worksheet part. Opening it reads the elements
+// before <sheetData> (the dimension), next decodes rows one at a time and
+// finish reads the rest of the part for the row count and merged cells.
+type xlsxSheetReader struct {
+	wb         *workbook
+	rc         io.ReadCloser
+	br         *bufio.Reader
+	decoder    *xml.Decoder
+	dimension  string
+	inRows     bool
+	last       int
+	merges     []mergeRange
+	hiddenRows []lineSpan
+	hiddenCols []lineSpan
+	// shared holds the formulas of shared formula groups by their si index,
+	// as given on the group's first cell.
+	shared map[string]*formula
+}
+
+func (wb *workbook) openXLSXSheet(sheet workbookSheet) (*xlsxSheetReader, error) {
+	r := &xlsxSheetReader{wb: wb}
+	if sheet.file == nil {
+		return r, nil
+	}
+	rc, err := sheet.file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sheet %q: %w", sheet.name, err)
+	}
+	r.rc = rc
+	// The decoder reads byte by byte from br without buffering of its own,
+	// so finish can pick up the part exactly where the decoder stopped.
+	r.br = bufio.NewReaderSize(rc, 64<<10)
+	r.decoder = xml.NewDecoder(r.br)
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			// A part without <sheetData> has no rows.
+			r.decoder = nil
+			return r, nil
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "worksheet":
+		case "sheetData":
+			r.inRows = true
+			return r, nil
+		case "dimension":
+			r.dimension = attrValue(start, "ref")
+			r.decoder.Skip()
+		case "cols":
+			var cols struct {
+				Col []struct {
+					Min    int    `xml:"min,attr"`
+					Max    int    `xml:"max,attr"`
+					Hidden string `xml:"hidden,attr"`
+				} `xml:"col"`
+			}
+			if err := r.decoder.DecodeElement(&cols, &start); err != nil {
+				r.decoder = nil
+				return r, nil
+			}
+			for _, c := range cols.Col {
+				if xmlBool(c.Hidden) && c.Min > 0 && c.Max >= c.Min {
+					r.hiddenCols = addSpan(r.hiddenCols, c.Min-1, c.Max-1)
+				}
+			}
+		default:
+			if err := r.decoder.Skip(); err != nil {
+				r.decoder = nil
+				return r, nil
+			}
+		}
+	}
+}
+
+func (r *xlsxSheetReader) lastRow() int { return r.last }
+
+func (r *xlsxSheetReader) mergeRanges() []mergeRange { return r.merges }
+
+func (r *xlsxSheetReader) hiddenLines() (rows, cols []lineSpan) {
+	return r.hiddenRows, r.hiddenCols
+}
+
+func (r *xlsxSheetReader) close() {
+	if r.rc != nil {
+		r.rc.Close()
+	}
+}
+
+// dimensionRows returns the last row of the worksheet's <dimension> element.
+// ok is false when the element is missing or names a single cell, which some
+// writers emit regardless of the sheet's size.
+func (r *xlsxSheetReader) dimensionRows() (int, bool) {
+	_, last, ok := strings.Cut(r.dimension, ":")
+	if !ok {
+		return 0, false
+	}
+	_, row, err := cellCoordinates(last)
+	if err != nil {
+		return 0, false
+	}
+	return row, true
+}
+
+// next decodes the next row. ok is false once the rows are exhausted.
+func (r *xlsxSheetReader) next() (sheetRow, bool, error) {
+	if !r.inRows {
+		return sheetRow{}, false, nil
+	}
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			r.inRows = false
+			return sheetRow{}, false, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "row" {
+				if err := r.decoder.Skip(); err != nil {
+					return sheetRow{}, false, err
+				}
+				continue
+			}
+			number := r.last + 1
+			if n, err := strconv.Atoi(attrValue(t, "r")); err == nil && n > r.last {
+				number = n
+			}
+			r.last = number
+			if xmlBool(attrValue(t, "hidden")) {
+				r.hiddenRows = addSpan(r.hiddenRows, number, number)
+			}
+			row := sheetRow{Number: number}
+			return row, true, r.readCells(&row)
+		case xml.EndElement:
+			// </sheetData>
+			r.inRows = false
+			return sheetRow{}, false, nil
+		}
+	}
+}
+
+// readCells decodes the cells of the row element just opened into row.
+func (r *xlsxSheetReader) readCells(row *sheetRow) error {
+	col := 0
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				if err := r.decoder.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			cellCol, err := r.readCell(t, col, row)
+			if err != nil {
+				return err
+			}
+			col = cellCol + 1
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// readCell decodes one <c> element, placing it at the column of its
+// reference or at pos when it has none, and returns that column. Cells with
+// no value (only a style) are left empty.
+func (r *xlsxSheetReader) readCell(start xml.StartElement, pos int, row *sheetRow) (int, error) {
+	col := pos
+	style := 0
+	cellType := ""
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "r":
+			if c, _, err := cellCoordinates(attr.Value); err == nil {
+				col = c
+			}
+		case "s":
+			style, _ = strconv.Atoi(attr.Value)
+		case "t":
+			cellType = attr.Value
+		}
+	}
+
+	var value string
+	var f *formula
+	hasValue := false
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return col, err
+		}
+		if _, ok := token.(xml.EndElement); ok {
+			break
+		}
+		el, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch el.Name.Local {
+		case "v":
+			if value, err = readCharData(r.decoder); err != nil {
+				return col, err
+			}
+			hasValue = true
+		case "is":
+			if value, err = readRichText(r.decoder, el); err != nil {
+				return col, err
+			}
+			hasValue = true
+		case "f":
+			if f, err = r.readFormula(el, row.Number, col); err != nil {
+				return col, err
+			}
+		default:
+			if err := r.decoder.Skip(); err != nil {
+				return col, err
+			}
+		}
+	}
+
+	cs := r.wb.style(style)
+	kind := formatGeneral
+	switch cellType {
+	case "b":
+		kind = formatBoolean
+	case "e":
+		kind = formatError
+	case "s", "str", "inlineStr", "d":
+	default:
+		kind = cs.format
+	}
+	if hasValue {
+		switch cellType {
+		case "s":
+			value = r.wb.sharedString(value)
+		case "", "n":
+			if kind == formatDate || kind == formatTime || kind == formatDateTime {
+				value = serialDateString(value, kind, r.wb.epoch)
+			}
+		}
+	}
+	row.setCell(col, value, hasValue, kind, cs.header)
+	if f != nil {
+		row.setFormula(col, f)
+	}
+	return col, nil
+}
+
+// readFormula decodes the <f> element just opened in the cell at row, col.
+// Cells of a shared formula group after the first carry only the group's si
+// index; in R1C1 terms their formula is the first cell's. Data table cells
+// have no formula text of their own and read as opaque.
+func (r *xlsxSheetReader) readFormula(start xml.StartElement, row, col int) (*formula, error) {
+	text, err := readCharData(r.decoder)
+	if err != nil {
+		return nil, err
+	}
+	kind, si := attrValue(start, "t"), attrValue(start, "si")
+	switch {
+	case kind == "dataTable":
+		return opaqueFormula, nil
+	case kind == "shared" && strings.TrimSpace(text) == "":
+		if f, ok := r.shared[si]; ok {
+			return f, nil
+		}
+		return opaqueFormula, nil
+	}
+	f := parseA1Formula(text, row, col)
+	if kind == "shared" {
+		if r.shared == nil {
+			r.shared = make(map[string]*formula)
+		}
+		r.shared[si] = f
+	}
+	return f, nil
+}
+
+// finish reads the rest of the part, counting the rows left and noting the
+// hidden ones, and collecting the merged cell ranges that follow them, then
+// closes the part. Rows that are only counted are not worth tokenizing, so
+// once the decoder is between elements the remaining bytes are scanned for
+// <row> and <mergeCell> tags directly. It stops with ctx's error once ctx is
+// done.
+func (r *xlsxSheetReader) finish(ctx context.Context) error {
+	defer r.close()
+	if r.decoder == nil {
+		return nil
+	}
+	var tag []byte
+	for n := 0; ; n++ {
+		if n%1024 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := r.br.ReadSlice('<'); err != nil {
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var err error
+		if tag, err = readTag(r.br, tag[:0]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch string(localName(tag)) {
+		case "row":
+			number := r.last + 1
+			if v, ok := tagAttr(tag, "r"); ok {
+				if n, err := strconv.Atoi(v); err == nil && n > r.last {
+					number = n
+				}
+			}
+			r.last = number
+			if v, ok := tagAttr(tag, "hidden"); ok && xmlBool(v) {
+				r.hiddenRows = addSpan(r.hiddenRows, number, number)
+			}
+		case "mergeCell":
+			if v, ok := tagAttr(tag, "ref"); ok {
+				if m, ok := parseMergeRef(v); ok {
+					r.merges = append(r.merges, m)
+				}
+			}
+		}
+	}
+}
+
+// readTag reads the rest of a tag whose "<" has been consumed, up to and
+// including its ">", into buf. Only row and mergeCell tags are read in full;
+// for others just enough is read to know the name.
+func readTag(br *bufio.Reader, buf []byte) ([]byte, error) {
+	quote := byte(0)
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return buf, err
+		}
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			buf = append(buf, c)
+			continue
+		}
+		switch c {
+		case '>':
+			return buf, nil
+		case '"', '\'':
+			quote = c
+		case ' ', '\t', '\r', '\n', '/':
+			if name := string(localName(buf)); name != "row" && name != "mergeCell" {
+				return buf, nil
+			}
+		}
+		buf = append(buf, c)
+	}
+}
+
+// localName returns the element name at the start of tag without its
+// namespace prefix.
+func localName(tag []byte) []byte {
+	end := bytes.IndexAny(tag, " \t\r\n/")
+	if end < 0 {
+		end = len(tag)
+	}
+	name := tag[:end]
+	if idx := bytes.IndexByte(name, ':'); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name
+}
+
+// tagAttr returns the value of attribute name in tag. Entities in the value
+// are not expanded, which row numbers and cell references never need.
+func tagAttr(tag []byte, name string) (string, bool) {
+	end := bytes.IndexAny(tag, " \t\r\n")
+	if end < 0 {
+		return "", false
+	}
+	rest := tag[end:]
+	for {
+		eq := bytes.IndexByte(rest, '=')
+		if eq < 0 {
+			return "", false
+		}
+		key := bytes.TrimSpace(rest[:eq])
+		rest = bytes.TrimLeft(rest[eq+1:], " \t\r\n")
+		if len(rest) == 0 {
+			return "", false
+		}
+		end := bytes.IndexByte(rest[1:], rest[0])
+		if end < 0 {
+			return "", false
+		}
+		if string(key) == name {
+			return string(rest[1 : end+1]), true
+		}
+		rest = rest[end+2:]
+	}
+}
+
+// sharedString returns shared string idx, or "" when idx is not a valid
+// index.
+func (wb *workbook) sharedString(idx string) string {
+	n, err := strconv.Atoi(strings.TrimSpace(idx))
+	if err != nil || n < 0 || n >= len(wb.sharedStrings) {
+		return ""
+	}
+	return wb.sharedStrings[n]
+}
+
+// serialDateString converts a date-formatted serial to text: "2006-01-02" for
+// whole days and RFC3339 otherwise. Time-only serials (below one day) always
+// land on Excel's zero date, which isTimeOfDay recognises. v is returned
+// unchanged when it is not a number.
+func serialDateString(v string, kind formatKind, epoch time.Time) string {
+	serial, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return v
+	}
+	if serial < 1 && serial >= 0 {
+		epoch = excelEpoch
+	}
+	days := math.Trunc(serial)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(math.Round((serial-days)*86400000)) * time.Millisecond)
+	if serial == days && kind != formatTime {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
+
+// xmlBool reads an xsd:boolean attribute value.
+func xmlBool(v string) bool {
+	return v == "1" || v == "true"
+}
+
+func attrValue(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// setAt sets s[idx] to v, growing s with zero values as needed.
+func setAt[T any](s []T, idx int, v T) []T {
+	for len(s) <= idx {
+		var zero T
+		s = append(s, zero)
+	}
+	s[idx] = v
+	return s
+}
+
+// from returns s[idx:], or nil when idx is out of range.
+func from[T any](s []T, idx int) []T {
+	if idx < 0 || idx >= len(s) {
+		return nil
+	}
+	return s[idx:]
+}
+
+// valueAt returns s[idx], or the zero value when idx is out of range.
+func valueAt[T any](s []T, idx int) T {
+	if idx < 0 || idx >= len(s) {
+		var zero T
+		return zero
+	}
+	return s[idx]
+}
+
+// scanSheetRows streams the rows of a sheet in worksheet order, calling fn
+// with each row until fn returns false or the sheet ends. It stops early with
+// an error once ctx is done.
+func (i *Inspector) scanSheetRows(ctx context.Context, sheetName string, fn func(sheetRow) bool) error {
+	r, err := i.openSheet(sheetName)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	for {
+		if ctx.Err() != nil {
+			return i.scanError(ctx, sheetName, r.lastRow())
+		}
+		row, ok, err := r.next()
+		if err != nil {
+			return fmt.Errorf("failed to read sheet %q at row %d: %w", sheetName, r.lastRow(), err)
+		}
+		if !ok || !fn(row) {
+			return nil
+		}
+	}
+}
+
+// sheetData is what one pass over a worksheet yields: its first
+// maxSampleRows rows with their formats, marks and formulas, indexed as
+// [row-1][col], and the facts about the whole sheet that need the rest of the
+// part. It is read once per Inspector and shared by the detail scan, the row
+// and column counts and the renderers.
+type sheetData struct {
+	rows       [][]string
+	formats    [][]formatKind
+	marks      [][]cellMark
+	formulas   [][]*formula
+	maxCols    int
+	firstWidth int
+	lastRow    int
+	truncated  bool
+	merges     []mergeRange
+	hiddenRows []lineSpan
+	hiddenCols []lineSpan
+}
+
+// rowCount returns the number of the sheet's last row, counted to the end
+// of the part, so it does not depend on a possibly stale dimension.
+func (d *sheetData) rowCount() int {
+	return max(d.lastRow, len(d.rows))
+}
+
+// sheetData returns the single-pass read of a sheet, reading it on first use.
+func (i *Inspector) sheetData(ctx context.Context, sheetName string) (*sheetData, error) {
+	if d := i.cachedSheet(sheetName); d != nil {
+		return d, nil
+	}
+	d, err := i.readSheetData(ctx, sheetName)
+	if err != nil {
+		return nil, err
+	}
+	i.sheetMu.Lock()
+	defer i.sheetMu.Unlock()
+	if i.sheetCache == nil {
+		i.sheetCache = make(map[string]*sheetData)
+	}
+	i.sheetCache[sheetName] = d
+	return d, nil
+}
+
+func (i *Inspector) cachedSheet(sheetName string) *sheetData {
+	i.sheetMu.Lock()
+	defer i.sheetMu.Unlock()
+	return i.sheetCache[sheetName]
+}
+
+// evictSheet drops the cached read of a sheet, so a later use reads it anew.
+func (i *Inspector) evictSheet(sheetName string) {
+	i.sheetMu.Lock()
+	defer i.sheetMu.Unlock()
+	delete(i.sheetCache, sheetName)
+}
+
+// readSheetData decodes the first maxSampleRows rows of a sheet, then skips
+// through the remaining rows, counting them, to the merged cell ranges at
+// the end of the part.
+func (i *Inspector) readSheetData(ctx context.Context, sheetName string) (*sheetData, error) {
+	r, err := i.openSheet(sheetName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	maxRows := i.config.maxSampleRows
+	d := &sheetData{
+		rows: make([][]string, 0, min(maxRows, defaultMaxSampleRows)),
+	}
+	first := true
+	for {
+		if ctx.Err() != nil {
+			return nil, i.scanError(ctx, sheetName, r.lastRow())
+		}
+		row, ok, err := r.next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet %q at row %d: %w", sheetName, r.lastRow(), err)
+		}
+		if !ok {
+			break
+		}
+		if first {
+			d.firstWidth = len(row.Values)
+			first = false
+		}
+		// Reading one row past maxRows tells a sheet that ends exactly at
+		// the limit from a truncated one.
+		if row.Number > maxRows {
+			d.truncated = true
+			break
+		}
+		// Pad skipped (empty) rows so rows[n-1] is always worksheet row n.
+		for len(d.rows) < row.Number-1 {
+			d.rows = append(d.rows, nil)
+		}
+		d.rows = append(d.rows, row.Values)
+		if row.formats != nil {
+			d.formats = setAt(d.formats, row.Number-1, row.formats)
+		}
+		if row.marks != nil {
+			d.marks = setAt(d.marks, row.Number-1, row.marks)
+		}
+		if row.formulas != nil {
+			d.formulas = setAt(d.formulas, row.Number-1, row.formulas)
+		}
+		d.maxCols = max(d.maxCols, len(row.Values))
+		if row.Number%100 == 0 || row.Number == maxRows {
+			i.emitProgress("scan_sheet_rows", sheetName, row.Number, maxRows)
+		}
+	}
+	if err := r.finish(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, i.scanError(ctx, sheetName, r.lastRow())
+		}
+		return nil, fmt.Errorf("failed to read sheet %q: %w", sheetName, err)
+	}
+	d.lastRow = r.lastRow()
+	d.merges = r.mergeRanges()
+	d.hiddenRows, d.hiddenCols = r.hiddenLines()
+	return d, nil
+}
+
+// sheetHead reads the column count of a sheet's first row and, when count is
+// set, its row count, decoding no more of the part than needed. A sheet that
+// has already been read is answered from its sheetData.
+func (i *Inspector) sheetHead(ctx context.Context, sheetName string, count bool) (rows, cols int, err error) {
+	if d := i.cachedSheet(sheetName); d != nil {
+		return d.rowCount(), d.firstWidth, nil
+	}
+	r, err := i.openSheet(sheetName)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.close()
+
+	row, ok, err := r.next()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read sheet %q at row %d: %w", sheetName, r.lastRow(), err)
+	}
+	if ok {
+		cols = len(row.Values)
+	}
+	if !count {
+		return 0, cols, nil
+	}
+	if n, ok := r.dimensionRows(); ok {
+		return n, cols, nil
+	}
+	if err := r.finish(ctx); err != nil {
+		if ctx.Err() != nil {
+			return 0, 0, i.scanError(ctx, sheetName, r.lastRow())
+		}
+		return 0, 0, fmt.Errorf("failed to read sheet %q: %w", sheetName, err)
+	}
+	return r.lastRow(), cols, nil
+}
@@ -0,0 +1,112 @@
+package excelinspect
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// NewFromReader opens a workbook of the given size read through r, such as a
+// multipart upload or an object fetched from storage. r must stay readable
+// until Close.
+func NewFromReader(r io.ReaderAt, size int64, opts ...InspectorOption) (*Inspector, error) {
+	return newInspector(r, size, "", nil, opts)
+}
+
+// NewFromBytes opens a workbook held in memory.
+func NewFromBytes(data []byte, opts ...InspectorOption) (*Inspector, error) {
+	return newInspector(bytes.NewReader(data), int64(len(data)), "", nil, opts)
+}
+
+// NewFromFS opens the workbook name in fsys. Files that support io.ReaderAt
+// (such as those of os.DirFS) are read in place and kept open until Close;
+// others are read into memory first.
+func NewFromFS(fsys fs.FS, name string, opts ...InspectorOption) (*Inspector, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if ra, ok := f.(io.ReaderAt); ok {
+		ins, err := newInspector(ra, st.Size(), name, f, opts)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return ins, nil
+	}
+
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read excel file: %w", err)
+	}
+	return newInspector(bytes.NewReader(data), int64(len(data)), name, nil, opts)
+}
+
+// newInspector opens the workbook in r, an .xlsx or .ods zip archive, an
+// .xls compound file or delimited text, and reads its sheet list, shared
+// strings and styles. Worksheets are read later, on demand. name is the
+// file's path, if known; closer, if set, is closed by Close.
+func newInspector(r io.ReaderAt, size int64, name string, closer io.Closer, opts []InspectorOption) (*Inspector, error) {
+	ins := &Inspector{
+		filePath: name,
+		closer:   closer,
+		config:   defaultInspectorConfig(),
+		detector: newDetector(VehicleInventoryProfile()),
+	}
+	for _, opt := range opts {
+		opt(ins)
+	}
+	wb, err := ins.openWorkbook(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open excel file: %w", err)
+	}
+	ins.wb = wb
+	return ins, nil
+}
+
+// openWorkbook reads the workbook in r, telling the formats apart by their
+// leading bytes. A compound file is an .xls workbook or an encrypted
+// package. Anything that is neither a zip archive nor a compound file
+// is read as delimited text, unless its name says it is an .xlsx, .xls or
+// .ods workbook, which a damaged one should not pass for. HTML tables
+// exported with an .xls name are rejected that way too.
+func (i *Inspector) openWorkbook(r io.ReaderAt, size int64) (*workbook, error) {
+	magic := make([]byte, len(cfbSignature))
+	n, _ := r.ReadAt(magic, 0)
+	switch magic = magic[:n]; {
+	case bytes.Equal(magic, cfbSignature):
+		return i.readCompoundFile(r)
+	case bytes.HasPrefix(magic, []byte("PK")):
+		return readZipWorkbook(r, size)
+	}
+	switch strings.ToLower(filepath.Ext(i.filePath)) {
+	case ".xlsx", ".xlsm", ".xltx", ".xltm", ".ods", ".ots":
+		return nil, zip.ErrFormat
+	case ".xls", ".xlt":
+		return nil, errors.New("not a valid .xls workbook (no compound file signature)")
+	}
+	return readText(r, size, textSheetName(i.filePath), i.config.delimiter)
+}
+
+// readZipWorkbook reads the .xlsx or .ods package in r.
+func readZipWorkbook(r io.ReaderAt, size int64) (*workbook, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if isODS(archive) {
+		return readODS(archive)
+	}
+	return readWorkbook(archive)
+}
@@ -0,0 +1,205 @@
+package excelinspect
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// excelTable is an Excel table (a ListObject) as its table part defines it:
+// its name, its range with 0-based inclusive bounds, the number of header
+// and totals rows at the top and bottom of that range, and its column names.
+type excelTable struct {
+	name       string
+	area       mergeRange
+	headerRows int
+	totalsRows int
+	columns    []string
+}
+
+// tableRelType ends the relationship type of a worksheet's table parts.
+const tableRelType = "/relationships/table"
+
+// readSheetTables reads the tables defined on the worksheet part sheetPart,
+// in the order of the worksheet's relationships. Table parts that are
+// missing or unreadable are left out.
+func readSheetTables(files map[string]*zip.File, sheetPart string) []excelTable {
+	if sheetPart == "" {
+		return nil
+	}
+	dir, base := path.Split(sheetPart)
+	rels, err := readRelationshipList(files[path.Join(dir, "_rels", base+".rels")], path.Clean(dir))
+	if err != nil {
+		return nil
+	}
+	var tables []excelTable
+	for _, rel := range rels {
+		if !strings.HasSuffix(rel.typ, tableRelType) {
+			continue
+		}
+		var part struct {
+			Name           string `xml:"name,attr"`
+			DisplayName    string `xml:"displayName,attr"`
+			Ref            string `xml:"ref,attr"`
+			HeaderRowCount *int   `xml:"headerRowCount,attr"`
+			TotalsRowCount int    `xml:"totalsRowCount,attr"`
+			Columns        []struct {
+				Name string `xml:"name,attr"`
+			} `xml:"tableColumns>tableColumn"`
+		}
+		if err := readZipXML(files[rel.target], &part); err != nil {
+			continue
+		}
+		area, ok := parseMergeRef(part.Ref)
+		if !ok {
+			continue
+		}
+		t := excelTable{
+			name:       part.DisplayName,
+			area:       area,
+			headerRows: 1,
+			totalsRows: max(0, part.TotalsRowCount),
+		}
+		if t.name == "" {
+			t.name = part.Name
+		}
+		if part.HeaderRowCount != nil {
+			t.headerRows = max(0, *part.HeaderRowCount)
+		}
+		for _, c := range part.Columns {
+			t.columns = append(t.columns, c.Name)
+		}
+		tables = append(tables, t)
+	}
+	return tables
+}
+
+// tableSections turns every table whose first row was scanned into a
+// section. The table part fixes the header row, the data rows and the
+// column names, so the section has full confidence; its rows may run past
+// the scanned prefix, as the table says. Tables starting past the prefix
+// are returned as unscanned, as "Name (B2000:D2100)".
+func (s *sheetScan) tableSections(tables []excelTable) (sections []Section, unscanned []string) {
+	sections = make([]Section, 0, len(tables))
+	for _, t := range tables {
+		top, bottom := t.area.top+1, t.area.bottom+1
+		ref := refArea{top: top, left: t.area.left, bottom: bottom, right: t.area.right}.a1()
+		if t.area.top >= len(s.rows) {
+			unscanned = append(unscanned, fmt.Sprintf("%s (%s)", t.name, ref))
+			continue
+		}
+		// For a table without a header row, the row above it stands in as
+		// the header row buildColumns counts data rows from; the columns
+		// get no start position.
+		headerRow := top + t.headerRows - 1
+		start := headerRow + 1
+		end := bottom - t.totalsRows
+		headers := t.columns
+		if width := t.area.right - t.area.left + 1; len(headers) != width {
+			headers = s.tableHeaders(t, headerRow, width)
+		}
+		sec := Section{
+			Title:            t.name,
+			Table:            t.name,
+			Range:            ref,
+			HeaderDepth:      t.headerRows,
+			HeaderConfidence: 1,
+			StartRow:         start,
+			EndRow:           end,
+			Headers:          headers,
+			Columns:          s.buildColumns(headerRow, t.area.left, headers, end),
+			RowCount:         max(0, end-start+1),
+			ColumnCount:      len(headers),
+		}
+		if t.headerRows > 0 {
+			sec.HeaderRow = headerRow
+		} else {
+			for idx := range sec.Columns {
+				sec.Columns[idx].StartPosition = ""
+			}
+		}
+		if t.totalsRows > 0 {
+			sec.TotalsRow = end + 1
+		}
+		sections = append(sections, sec)
+	}
+	return sections, unscanned
+}
+
+// tableHeaders returns width column names for a table whose part does not
+// list one per column, taken from its header row where it has one and
+// otherwise made up as "Column N".
+func (s *sheetScan) tableHeaders(t excelTable, headerRow, width int) []string {
+	headers := make([]string, width)
+	var row []string
+	if t.headerRows > 0 && headerRow <= len(s.rows) {
+		row = s.rows[headerRow-1]
+	}
+	for idx := range headers {
+		headers[idx] = valueAt(row, t.area.left+idx)
+		if headers[idx] == "" {
+			headers[idx] = valueAt(t.columns, idx)
+		}
+		if headers[idx] == "" {
+			headers[idx] = fmt.Sprintf("Column %d", idx+1)
+		}
+	}
+	return headers
+}
+
+// withoutTables returns a copy of the scan with the cells of tables blanked,
+// so section detection only sees the regions no table covers. Rows outside
+// every table are shared with s.
+func (s *sheetScan) withoutTables(tables []excelTable) *sheetScan {
+	masked := *s
+	masked.rows = make([][]string, len(s.rows))
+	for idx, row := range s.rows {
+		masked.rows[idx] = row
+		copied := false
+		for _, t := range tables {
+			if idx < t.area.top || idx > t.area.bottom || t.area.left >= len(row) {
+				continue
+			}
+			if !copied {
+				masked.rows[idx] = append([]string(nil), row...)
+				copied = true
+			}
+			for col := t.area.left; col <= t.area.right && col < len(row); col++ {
+				masked.rows[idx][col] = ""
+			}
+		}
+	}
+	return &masked
+}
+
+// combineSections merges table sections with the sections detected around
+// them, in sheet order.
+func combineSections(tables, detected []Section) []Section {
+	if len(tables) == 0 {
+		return detected
+	}
+	sections := append(tables, detected...)
+	slices.SortStableFunc(sections, func(a, b Section) int {
+		if a.StartRow != b.StartRow {
+			return a.StartRow - b.StartRow
+		}
+		return a.firstColumn() - b.firstColumn()
+	})
+	return sections
+}
+
+// firstColumn returns the 0-based sheet column of the section's first
+// column: a table's first column, and column A for detected sections.
+func (s Section) firstColumn() int {
+	if s.Range == "" {
+		return 0
+	}
+	first, _, _ := strings.Cut(s.Range, ":")
+	col, _, err := cellCoordinates(first)
+	if err != nil {
+		return 0
+	}
+	return col
+}
@@ -0,0 +1,473 @@
+package excelinspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value types reported in ColumnInfo.DataType and ColumnInfo.TypeCounts.
+const (
+	DataTypeEmpty      = "empty"
+	DataTypeString     = "string"
+	DataTypeInteger    = "integer"
+	DataTypeDecimal    = "decimal"
+	DataTypeDate       = "date"
+	DataTypeDateTime   = "datetime"
+	DataTypeTime       = "time"
+	DataTypeBoolean    = "boolean"
+	DataTypePercentage = "percentage"
+	DataTypeCurrency   = "currency"
+	DataTypeError      = "error"
+)
+
+// dataTypeOrder breaks ties when picking a column's dominant type.
+var dataTypeOrder = []string{
+	DataTypeInteger, DataTypeDecimal, DataTypeCurrency, DataTypePercentage,
+	DataTypeDate, DataTypeDateTime, DataTypeTime, DataTypeBoolean,
+	DataTypeString, DataTypeError,
+}
+
+// formatKind is what a cell's number format (or cell type attribute) says
+// about its value, independent of the formatted text.
+type formatKind uint8
+
+const (
+	formatGeneral formatKind = iota
+	formatPercent
+	formatCurrency
+	formatDate
+	formatTime
+	formatDateTime
+	formatBoolean
+	formatError
+)
+
+// excelErrorValues are the error literals Excel stores as cell values.
+var excelErrorValues = map[string]bool{
+	"#NULL!": true, "#DIV/0!": true, "#VALUE!": true, "#REF!": true, "#NAME?": true,
+	"#NUM!": true, "#N/A": true, "#GETTING_DATA": true, "#SPILL!": true, "#CALC!": true,
+	"#FIELD!": true, "#BLOCKED!": true, "#CONNECT!": true, "#BUSY!": true, "#UNKNOWN!": true,
+}
+
+var (
+	thousandsIntPattern = regexp.MustCompile(`^[+-]?\d{1,3}(,\d{3})+$`)
+	thousandsDecPattern = regexp.MustCompile(`^[+-]?\d{1,3}(,\d{3})*\.\d+$`)
+	percentPattern      = regexp.MustCompile(`^[+-]?\d[\d,]*(\.\d+)?\s?%$`)
+	currencyPattern     = regexp.MustCompile(`^(?i)(?:[$€£¥₹₩]|rp\.?|idr|usd|eur|gbp|sgd)\s?[+-]?\d[\d.,]*$|^[+-]?\d[\d.,]*\s?(?i:[$€£¥₹₩]|idr|usd|eur|gbp|sgd)$`)
+	timePattern         = regexp.MustCompile(`^\d{1,2}:\d{2}(:\d{2}(\.\d+)?)?(\s?[AaPp][Mm])?$`)
+	// formatLiteralPattern matches the bracketed, escaped and quoted parts of
+	// a number format code, which carry no date or percent meaning.
+	formatLiteralPattern = regexp.MustCompile(`\[[^\]]*\]|\\.|"[^"]*"`)
+)
+
+var dateLayouts = []string{
+	"2006-01-02", "2006/01/02", "02/01/2006", "01/02/2006", "2/1/2006", "02-01-2006",
+	"2-Jan-2006", "02-Jan-2006", "2 Jan 2006", "2 January 2006", "Jan 2, 2006", "January 2, 2006",
+}
+
+var dateTimeLayouts = []string{
+	time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04",
+	"2006/01/02 15:04:05", "02/01/2006 15:04:05", "02/01/2006 15:04",
+}
+
+// inferValueType classifies one trimmed cell value, using the cell's format
+// kind where the text alone is ambiguous (a percentage stored as 0.25, a
+// boolean stored as 1).
+func inferValueType(v string, kind formatKind) string {
+	if v == "" {
+		return DataTypeEmpty
+	}
+	if excelErrorValues[strings.ToUpper(v)] || kind == formatError {
+		return DataTypeError
+	}
+	switch kind {
+	case formatBoolean:
+		return DataTypeBoolean
+	case formatPercent:
+		if isNumeric(v) {
+			return DataTypePercentage
+		}
+	case formatCurrency:
+		if isNumeric(v) {
+			return DataTypeCurrency
+		}
+	case formatTime:
+		if isNumeric(v) || isTimeOfDay(v) {
+			return DataTypeTime
+		}
+	case formatDate:
+		if isNumeric(v) {
+			return DataTypeDate
+		}
+	case formatDateTime:
+		if isNumeric(v) {
+			return DataTypeDateTime
+		}
+	}
+	return inferTextType(v)
+}
+
+// inferTextType classifies a value from its text alone.
+func inferTextType(v string) string {
+	upper := strings.ToUpper(v)
+	switch {
+	case upper == "TRUE" || upper == "FALSE":
+		return DataTypeBoolean
+	case isInteger(v):
+		return DataTypeInteger
+	case isNumeric(v) || thousandsDecPattern.MatchString(v):
+		return DataTypeDecimal
+	case percentPattern.MatchString(v):
+		return DataTypePercentage
+	case currencyPattern.MatchString(v):
+		return DataTypeCurrency
+	case timePattern.MatchString(v):
+		return DataTypeTime
+	}
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			if isExcelTimeOnly(t) {
+				return DataTypeTime
+			}
+			return DataTypeDateTime
+		}
+	}
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			return DataTypeDate
+		}
+	}
+	return DataTypeString
+}
+
+func isInteger(v string) bool {
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return true
+	}
+	return thousandsIntPattern.MatchString(v)
+}
+
+// isNumeric reports whether v parses as a finite float. strconv accepts "Inf"
+// and "NaN", which are words here, so a digit is required.
+func isNumeric(v string) bool {
+	if !strings.ContainsAny(v, "0123456789") {
+		return false
+	}
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil
+}
+
+// isTimeOfDay reports whether v is a time of day, either as text or as the
+// datetime on Excel's zero date that time-formatted serials convert to.
+func isTimeOfDay(v string) bool {
+	if timePattern.MatchString(v) {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return err == nil && isExcelTimeOnly(t)
+}
+
+// isExcelTimeOnly reports whether t falls on Excel's zero date, which is how
+// serials below 1 (a time with no date) come out when converted.
+func isExcelTimeOnly(t time.Time) bool {
+	return t.Year() == 1899 && t.Month() == time.December && (t.Day() == 30 || t.Day() == 31)
+}
+
+// currencyAffixes are stripped from currency values before parsing them.
+var currencyAffixes = []string{"$", "€", "£", "¥", "₹", "₩", "RP.", "RP", "IDR", "USD", "EUR", "GBP", "SGD"}
+
+// parseNumberValue parses an integer, decimal, percentage or currency value
+// of the given inferred type. Text percentages ("12%") are returned as
+// fractions, matching how Excel stores percent-formatted numbers.
+func parseNumberValue(v string, dataType string) (float64, bool) {
+	switch dataType {
+	case DataTypeInteger, DataTypeDecimal, DataTypePercentage, DataTypeCurrency:
+	default:
+		return 0, false
+	}
+	s := strings.TrimSpace(v)
+	percent := strings.HasSuffix(s, "%")
+	s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+	if dataType == DataTypeCurrency {
+		upper := strings.ToUpper(s)
+		for _, affix := range currencyAffixes {
+			if strings.HasPrefix(upper, affix) {
+				s, upper = strings.TrimSpace(s[len(affix):]), strings.TrimSpace(upper[len(affix):])
+			}
+			if strings.HasSuffix(upper, affix) {
+				s, upper = strings.TrimSpace(s[:len(s)-len(affix)]), strings.TrimSpace(upper[:len(upper)-len(affix)])
+			}
+		}
+	}
+	s = strings.ReplaceAll(s, ",", "")
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	if percent {
+		n /= 100
+	}
+	return n, true
+}
+
+// excelEpoch is day zero of Excel's 1900 date system, adjusted for the
+// fictitious 1900-02-29 so serials after February 1900 convert correctly.
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// parseTimeValue parses a date, datetime or time value of the given inferred
+// type, either as text or as an Excel serial number.
+func parseTimeValue(v string, dataType string) (time.Time, bool) {
+	switch dataType {
+	case DataTypeDate, DataTypeDateTime, DataTypeTime:
+	default:
+		return time.Time{}, false
+	}
+	if serial, err := strconv.ParseFloat(v, 64); err == nil {
+		ms := math.Round(serial * 86400000)
+		return excelEpoch.Add(time.Duration(ms) * time.Millisecond), true
+	}
+	layouts := append(append([]string{}, dateTimeLayouts...), dateLayouts...)
+	if dataType == DataTypeTime {
+		layouts = append(layouts, "15:04", "15:04:05", "3:04 PM", "3:04PM", "3:04:05 PM", "15:04:05.999999999")
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			if t.Year() == 0 {
+				// Bare times parse onto year 0; move them to Excel's zero date
+				// so they compare with converted serials.
+				t = excelEpoch.Add(t.Sub(time.Date(0, time.January, 1, 0, 0, 0, 0, time.UTC)))
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// columnTypeStats accumulates the inferred types of one column.
+type columnTypeStats map[string]int
+
+func (s columnTypeStats) add(dataType string) {
+	s[dataType]++
+}
+
+// dominant returns the most frequent non-empty type, or "empty" when the
+// column holds no values.
+func (s columnTypeStats) dominant() string {
+	best, bestCount := DataTypeEmpty, 0
+	for _, t := range dataTypeOrder {
+		if s[t] > bestCount {
+			best, bestCount = t, s[t]
+		}
+	}
+	return best
+}
+
+// mixed reports whether more than one non-empty type was seen.
+func (s columnTypeStats) mixed() bool {
+	seen := 0
+	for t, n := range s {
+		if t != DataTypeEmpty && n > 0 {
+			seen++
+		}
+	}
+	return seen > 1
+}
+
+// addTypeCounts returns a new histogram holding the sum of a and b, leaving
+// both untouched since they may be shared by several sections.
+func addTypeCounts(a, b map[string]int) map[string]int {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(a)+len(b))
+	for t, n := range a {
+		out[t] += n
+	}
+	for t, n := range b {
+		out[t] += n
+	}
+	return out
+}
+
+// formatTypeCounts renders a histogram as "integer=19, error=1" in
+// dataTypeOrder, followed by the empty count.
+func formatTypeCounts(counts map[string]int, sep string) string {
+	parts := make([]string, 0, len(counts))
+	for _, t := range append(dataTypeOrder, DataTypeEmpty) {
+		if counts[t] > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", t, counts[t]))
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// builtinFormatKinds classifies Excel's built-in number format IDs.
+var builtinFormatKinds = map[int]formatKind{
+	5: formatCurrency, 6: formatCurrency, 7: formatCurrency, 8: formatCurrency,
+	9: formatPercent, 10: formatPercent,
+	14: formatDate, 15: formatDate, 16: formatDate, 17: formatDate,
+	18: formatTime, 19: formatTime, 20: formatTime, 21: formatTime,
+	22: formatDateTime,
+	27: formatDate, 28: formatDate, 29: formatDate, 30: formatDate, 31: formatDate,
+	32: formatTime, 33: formatTime, 34: formatTime, 35: formatTime, 36: formatDate,
+	42: formatCurrency, 44: formatCurrency,
+	45: formatTime, 46: formatTime, 47: formatTime,
+	50: formatDate, 51: formatDate, 52: formatDate, 53: formatDate, 54: formatDate,
+	55: formatDate, 56: formatDate, 57: formatDate, 58: formatDate,
+}
+
+// classifyFormatCode classifies a custom number format code.
+func classifyFormatCode(code string) formatKind {
+	if code == "" || strings.EqualFold(code, "General") || code == "@" {
+		return formatGeneral
+	}
+	// Only the positive section decides the kind.
+	section, _, _ := strings.Cut(code, ";")
+	if strings.Contains(section, "[$") {
+		symbol := section[strings.Index(section, "[$")+2:]
+		if end := strings.IndexAny(symbol, "-]"); end > 0 {
+			return formatCurrency
+		}
+	}
+	if strings.ContainsAny(section, "$€£¥₹₩") || strings.Contains(section, `"Rp`) {
+		return formatCurrency
+	}
+	stripped := formatLiteralPattern.ReplaceAllString(section, "")
+	if strings.Contains(stripped, "%") {
+		return formatPercent
+	}
+	hasDate := strings.ContainsAny(stripped, "yYdD")
+	hasTime := strings.ContainsAny(stripped, "hHsS")
+	switch {
+	case hasDate && hasTime:
+		return formatDateTime
+	case hasDate:
+		return formatDate
+	case hasTime:
+		return formatTime
+	case strings.ContainsAny(stripped, "mM") && !strings.ContainsAny(stripped, "0#?"):
+		return formatDate
+	}
+	return formatGeneral
+}
+
+// cellCoordinates returns the 0-based column and 1-based row of a cell
+// reference such as "B12".
+func cellCoordinates(ref string) (int, int, error) {
+	col := 0
+	idx := 0
+	for idx < len(ref) {
+		ch := ref[idx]
+		if ch >= 'a' && ch <= 'z' {
+			ch -= 'a' - 'A'
+		}
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+		idx++
+	}
+	if col == 0 {
+		return 0, 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	row, err := strconv.Atoi(ref[idx:])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cell reference %q: %w", ref, err)
+	}
+	return col - 1, row, nil
+}
+
+// formatKindAt returns the format kind of a cell, or formatGeneral when the
+// cell has none recorded.
+func formatKindAt(formats [][]formatKind, row, col int) formatKind {
+	if row < 1 || row > len(formats) || col >= len(formats[row-1]) {
+		return formatGeneral
+	}
+	return formats[row-1][col]
+}
+
+// ExcelError is an Excel error value such as "#N/A" or "#DIV/0!", returned as
+// a typed value when WithTypedValues is on. It marshals to JSON as
+// {"error": "#N/A"} so it stays distinguishable from text.
+type ExcelError string
+
+func (e ExcelError) Error() string {
+	return string(e)
+}
+
+func (e ExcelError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"error": string(e)})
+}
+
+// WithTypedValues makes ColumnInfo.SampleValues hold native Go values instead
+// of strings, and fills SectionRow.TypedValues. Values are converted using the
+// inferred type: int64 for integers, float64 for decimals, percentages (as
+// fractions) and currency amounts, time.Time for dates, datetimes and times,
+// bool for booleans, ExcelError for error values, string for text and nil
+// for empty cells.
+func WithTypedValues(enabled bool) InspectorOption {
+	return func(i *Inspector) {
+		i.config.typedValues = enabled
+	}
+}
+
+// typedCellValue converts a trimmed cell value of the given inferred type to
+// its native Go value, falling back to the string when it does not parse.
+func typedCellValue(v string, dataType string) interface{} {
+	switch dataType {
+	case DataTypeEmpty:
+		return nil
+	case DataTypeInteger:
+		if n, err := strconv.ParseInt(strings.ReplaceAll(v, ",", ""), 10, 64); err == nil {
+			return n
+		}
+		if n, ok := parseNumberValue(v, DataTypeDecimal); ok {
+			return n
+		}
+	case DataTypeDecimal, DataTypePercentage, DataTypeCurrency:
+		if n, ok := parseNumberValue(v, dataType); ok {
+			return n
+		}
+	case DataTypeDate, DataTypeDateTime, DataTypeTime:
+		if t, ok := parseTimeValue(v, dataType); ok {
+			return t
+		}
+	case DataTypeBoolean:
+		switch strings.ToUpper(v) {
+		case "1", "TRUE":
+			return true
+		case "0", "FALSE":
+			return false
+		}
+	case DataTypeError:
+		return ExcelError(strings.ToUpper(v))
+	}
+	return v
+}
+
+// formatValue renders a sample value, typed or not, as text for Markdown and
+// TOON.
+func formatValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case time.Time:
+		switch {
+		case isExcelTimeOnly(t):
+			return t.Format("15:04:05")
+		case t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0:
+			return t.Format("2006-01-02")
+		}
+		return t.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,212 @@
+package excelinspect
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestClassifyFormatCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want formatKind
+	}{
+		{"", formatGeneral},
+		{"General", formatGeneral},
+		{"@", formatGeneral},
+		{"0.00", formatGeneral},
+		{"#,##0;[Red]-#,##0", formatGeneral},
+		{`0"%"`, formatGeneral},
+		{`\d0`, formatGeneral},
+		{"yyyy-mm-dd", formatDate},
+		{"dd/mm/yyyy", formatDate},
+		{"mmm-yy", formatDate},
+		{"mmmm", formatDate},
+		{"h:mm AM/PM", formatTime},
+		{"[h]:mm:ss", formatTime},
+		{"mm:ss", formatTime},
+		{"yyyy-mm-dd hh:mm", formatDateTime},
+		{"0%", formatPercent},
+		{"0.00%;-0.00%", formatPercent},
+		{`"$"#,##0.00`, formatCurrency},
+		{"[$€-407] #,##0.00", formatCurrency},
+		{"#,##0.00 [$EUR]", formatCurrency},
+		{`"Rp"#,##0`, formatCurrency},
+		{"£#,##0", formatCurrency},
+	}
+	for _, tt := range tests {
+		if got := classifyFormatCode(tt.code); got != tt.want {
+			t.Errorf("classifyFormatCode(%q) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestBuiltinFormatKinds(t *testing.T) {
+	tests := []struct {
+		id   int
+		want formatKind
+	}{
+		{0, formatGeneral},
+		{2, formatGeneral},
+		{9, formatPercent},
+		{10, formatPercent},
+		{14, formatDate},
+		{17, formatDate},
+		{20, formatTime},
+		{22, formatDateTime},
+		{44, formatCurrency},
+		{46, formatTime},
+	}
+	for _, tt := range tests {
+		if got := builtinFormatKinds[tt.id]; got != tt.want {
+			t.Errorf("builtinFormatKinds[%d] = %d, want %d", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestInferValueType(t *testing.T) {
+	tests := []struct {
+		v    string
+		kind formatKind
+		want string
+	}{
+		{"", formatGeneral, DataTypeEmpty},
+		{"#DIV/0!", formatGeneral, DataTypeError},
+		{"#n/a", formatGeneral, DataTypeError},
+		{"#SPILL!", formatGeneral, DataTypeError},
+		{"1", formatError, DataTypeError},
+		{"N/A", formatGeneral, DataTypeString},
+		{"45352", formatDate, DataTypeDate},
+		{"45352.5", formatDateTime, DataTypeDateTime},
+		{"0.5", formatTime, DataTypeTime},
+		{"12:30", formatTime, DataTypeTime},
+		{"not a date", formatDate, DataTypeString},
+		{"0.25", formatPercent, DataTypePercentage},
+		{"12%", formatGeneral, DataTypePercentage},
+		{"-3.5 %", formatGeneral, DataTypePercentage},
+		{"1234.5", formatCurrency, DataTypeCurrency},
+		{"$1,234.50", formatGeneral, DataTypeCurrency},
+		{"1.234 EUR", formatGeneral, DataTypeCurrency},
+		{"Rp 15.000", formatGeneral, DataTypeCurrency},
+		{"1", formatBoolean, DataTypeBoolean},
+		{"TRUE", formatGeneral, DataTypeBoolean},
+		{"false", formatGeneral, DataTypeBoolean},
+		{"42", formatGeneral, DataTypeInteger},
+		{"1,234", formatGeneral, DataTypeInteger},
+		{"3.14", formatGeneral, DataTypeDecimal},
+		{"1,234.5", formatGeneral, DataTypeDecimal},
+		{"Inf", formatGeneral, DataTypeString},
+		{"2024-03-01", formatGeneral, DataTypeDate},
+		{"1 March 2024", formatGeneral, DataTypeDate},
+		{"2024-03-01 10:00:00", formatGeneral, DataTypeDateTime},
+		{"1899-12-30T10:00:00Z", formatGeneral, DataTypeTime},
+		{"10:30 PM", formatGeneral, DataTypeTime},
+		{"hello", formatGeneral, DataTypeString},
+	}
+	for _, tt := range tests {
+		if got := inferValueType(tt.v, tt.kind); got != tt.want {
+			t.Errorf("inferValueType(%q, %d) = %q, want %q", tt.v, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestSerialDateString(t *testing.T) {
+	tests := []struct {
+		v     string
+		kind  formatKind
+		epoch string
+		want  string
+	}{
+		{"45352", formatDate, "1900", "2024-03-01"},
+		{"45352.5", formatDateTime, "1900", "2024-03-01T12:00:00Z"},
+		{"45352", formatTime, "1900", "2024-03-01T00:00:00Z"},
+		{"0.75", formatTime, "1900", "1899-12-30T18:00:00Z"},
+		{"43890", formatDate, "1904", "2024-03-01"},
+		{"43890.25", formatDateTime, "1904", "2024-03-01T06:00:00Z"},
+		// Times without a date do not depend on the date system.
+		{"0.75", formatTime, "1904", "1899-12-30T18:00:00Z"},
+		{"n/a", formatDate, "1900", "n/a"},
+	}
+	for _, tt := range tests {
+		epoch := excelEpoch
+		if tt.epoch == "1904" {
+			epoch = date1904Epoch
+		}
+		if got := serialDateString(tt.v, tt.kind, epoch); got != tt.want {
+			t.Errorf("serialDateString(%q, %d, %s) = %q, want %q", tt.v, tt.kind, tt.epoch, got, tt.want)
+		}
+	}
+}
+
+func TestColumnTypeStats(t *testing.T) {
+	s := columnTypeStats{}
+	for _, typ := range []string{DataTypeInteger, DataTypeString, DataTypeInteger, DataTypeEmpty, DataTypeError, DataTypeInteger, DataTypeEmpty} {
+		s.add(typ)
+	}
+	if got := s.dominant(); got != DataTypeInteger {
+		t.Errorf("dominant = %q, want integer", got)
+	}
+	if !s.mixed() {
+		t.Error("mixed = false, want true")
+	}
+	if got, want := formatTypeCounts(s, ", "), "integer=3, string=1, error=1, empty=2"; got != want {
+		t.Errorf("type counts = %q, want %q", got, want)
+	}
+
+	// Ties go to the type listed first in dataTypeOrder.
+	tie := columnTypeStats{DataTypeString: 2, DataTypeDate: 2}
+	if got := tie.dominant(); got != DataTypeDate {
+		t.Errorf("dominant of a tie = %q, want date", got)
+	}
+	if got := (columnTypeStats{DataTypeEmpty: 4}).dominant(); got != DataTypeEmpty {
+		t.Errorf("dominant of an empty column = %q, want empty", got)
+	}
+}
+
+func TestColumnTypesOfMixedColumns(t *testing.T) {
+	// QTY mixes integers with an error and a word; DUE holds date-formatted
+	// serials, one of them stored as text.
+	rows := xrow(1, 1, "ITEM", "QTY", "DUE")
+	cell := func(ref string, style int, v string) string {
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return fmt.Sprintf(`<c r="%s" s="%d" t="str"><v>%s</v></c>`, ref, style, v)
+		}
+		return fmt.Sprintf(`<c r="%s" s="%d"><v>%s</v></c>`, ref, style, v)
+	}
+	for idx, v := range [][2]string{{"1", "45352"}, {"2", "45353"}, {"3", "45354"}, {"#N/A", "45355"}, {"n/a", "soon"}} {
+		n := idx + 2
+		rows += fmt.Sprintf(`<row r="%d">%s%s%s</row>`, n,
+			cell(fmt.Sprintf("A%d", n), 0, fmt.Sprintf("item%d", n)),
+			cell(fmt.Sprintf("B%d", n), 0, v[0]),
+			cell(fmt.Sprintf("C%d", n), 2, v[1]))
+	}
+	ins := openTestWorkbook(t, xlsxFile(t, []testSheet{{name: "Orders", rows: rows}}, "", nil))
+	detail, err := ins.inspectSheetDetail(context.Background(), "Orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := make(map[string]ColumnInfo)
+	for _, c := range detail.Columns {
+		columns[c.Name] = c
+	}
+
+	qty := columns["QTY"]
+	if qty.DataType != DataTypeInteger {
+		t.Errorf("QTY type = %q, want integer", qty.DataType)
+	}
+	if want := map[string]int{DataTypeInteger: 3, DataTypeError: 1, DataTypeString: 1}; !reflect.DeepEqual(qty.TypeCounts, want) {
+		t.Errorf("QTY type_counts = %v, want %v", qty.TypeCounts, want)
+	}
+	due := columns["DUE"]
+	if due.DataType != DataTypeDate {
+		t.Errorf("DUE type = %q, want date", due.DataType)
+	}
+	if want := map[string]int{DataTypeDate: 4, DataTypeString: 1}; !reflect.DeepEqual(due.TypeCounts, want) {
+		t.Errorf("DUE type_counts = %v, want %v", due.TypeCounts, want)
+	}
+	if len(due.SampleValues) == 0 || due.SampleValues[0] != "2024-03-01" {
+		t.Errorf("DUE samples = %v, want 2024-03-01 first", due.SampleValues)
+	}
+}
@@ -0,0 +1,119 @@
+package excelinspect
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Sheet visibility states reported in SheetInfo.Visibility and
+// SkippedSheet.Visibility. A very hidden sheet can only be shown again from
+// VBA, so it often holds lookup tables the workbook's author kept out of
+// sight on purpose.
+const (
+	SheetVisible    = "visible"
+	SheetHidden     = "hidden"
+	SheetVeryHidden = "veryHidden"
+)
+
+// Reasons a sheet is listed in FileInfo.SkippedSheets.
+const (
+	// SkipReasonHidden marks a hidden or very hidden sheet left out because
+	// WithHiddenSheets is off.
+	SkipReasonHidden = "hidden"
+	// SkipReasonFiltered marks a sheet that the WithSheetFilter patterns do
+	// not select.
+	SkipReasonFiltered = "filtered"
+)
+
+// SkippedSheet is a sheet of the workbook that was not inspected, with the
+// reason why.
+type SkippedSheet struct {
+	Name       string `json:"name"`
+	Visibility string `json:"visibility"`
+	Reason     string `json:"reason"`
+}
+
+// WithHiddenSheets includes hidden and very hidden sheets in the inspection
+// instead of listing them in FileInfo.SkippedSheets. SheetInfo.Visibility
+// tells them apart from visible ones.
+func WithHiddenSheets(include bool) InspectorOption {
+	return func(i *Inspector) {
+		i.config.hiddenSheets = include
+	}
+}
+
+// sheetVisibility returns the visibility of the named sheet; a state the
+// reader did not set or does not know means visible.
+func (i *Inspector) sheetVisibility(sheetName string) string {
+	sheet, _ := i.wb.sheet(sheetName)
+	switch sheet.state {
+	case SheetHidden, SheetVeryHidden:
+		return sheet.state
+	}
+	return SheetVisible
+}
+
+// selectSheets splits sheets into those to inspect, in workbook order, and
+// those skipped because they are hidden or filtered out.
+func (i *Inspector) selectSheets(sheets []string) ([]string, []SkippedSheet) {
+	selected := make([]string, 0, len(sheets))
+	var skipped []SkippedSheet
+	for _, sheetName := range sheets {
+		visibility := i.sheetVisibility(sheetName)
+		switch {
+		case visibility != SheetVisible && !i.config.hiddenSheets:
+			skipped = append(skipped, SkippedSheet{Name: sheetName, Visibility: visibility, Reason: SkipReasonHidden})
+		case !i.sheetSelected(sheetName):
+			skipped = append(skipped, SkippedSheet{Name: sheetName, Visibility: visibility, Reason: SkipReasonFiltered})
+		default:
+			selected = append(selected, sheetName)
+		}
+	}
+	return selected, skipped
+}
+
+// lineSpan is a run of rows or columns, first to last inclusive. Rows are
+// 1-based and columns 0-based, as elsewhere in the readers.
+type lineSpan struct {
+	first, last int
+}
+
+// addSpan appends the run first..last to spans, extending the last span
+// when the run continues it. Runs must be added in order.
+func addSpan(spans []lineSpan, first, last int) []lineSpan {
+	if n := len(spans); n > 0 && first <= spans[n-1].last+1 {
+		spans[n-1].last = max(spans[n-1].last, last)
+		return spans
+	}
+	return append(spans, lineSpan{first: first, last: last})
+}
+
+// rowSpanLabels formats row spans as "5" or "7:9", the way Excel names
+// whole rows.
+func rowSpanLabels(spans []lineSpan) []string {
+	return spanLabels(spans, strconv.Itoa)
+}
+
+// columnSpanLabels formats column spans as "C" or "E:G".
+func columnSpanLabels(spans []lineSpan) []string {
+	return spanLabels(spans, columnLetter)
+}
+
+func spanLabels(spans []lineSpan, name func(int) string) []string {
+	if len(spans) == 0 {
+		return nil
+	}
+	out := make([]string, len(spans))
+	for idx, s := range spans {
+		out[idx] = name(s.first)
+		if s.last != s.first {
+			out[idx] += ":" + name(s.last)
+		}
+	}
+	return out
+}
+
+// joinLabels joins span labels for one-line output.
+func joinLabels(labels []string) string {
+	return strings.Join(labels, ", ")
+}
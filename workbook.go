@@ -0,0 +1,366 @@
+package excelinspect
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// workbook holds the workbook-level parts that every sheet read needs: the
+// sheet list, shared strings and cell styles, and the defined names. It is
+// read once when the Inspector is opened, from an .xlsx package or, for .xls
+// files, from the globals of the BIFF8 stream kept in biff. An .ods file's
+// tables are read from ods; CSV/TSV input is a workbook with one sheet, read
+// from text.
+type workbook struct {
+	sheets        []workbookSheet
+	sharedStrings []string
+	styles        []cellStyle
+	epoch         time.Time
+	names         []workbookName
+	biff          []byte
+	ods           *odsContent
+	text          *textSource
+}
+
+// workbookSheet is one entry of the workbook's sheet list. file (.xlsx) is
+// nil and offset (.xls: the sheet's BOF record in biff; .ods: its table
+// element in content.xml) is negative when the sheet has no cells of its
+// own, as with chart sheets. tables are the Excel tables defined on the
+// sheet (.xlsx only).
+type workbookSheet struct {
+	name   string
+	state  string
+	file   *zip.File
+	offset int
+	tables []excelTable
+}
+
+// cellStyle is the part of a cellXfs entry the inspector uses, indexed by a
+// cell's s attribute.
+type cellStyle struct {
+	format formatKind
+	// header is set for bold fonts and bottom borders, the styling
+	// headerStyleProbe looks for.
+	header bool
+}
+
+// date1904Epoch is day zero of workbooks saved with the 1904 date system.
+var date1904Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// readWorkbook reads the sheet list, shared strings and styles of archive.
+// Missing shared strings or styles are not an error; cells referring to them
+// read as empty or General.
+func readWorkbook(archive *zip.Reader) (*workbook, error) {
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	var wbXML struct {
+		Pr struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name  string `xml:"name,attr"`
+			State string `xml:"state,attr"`
+			RID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+		DefinedNames []struct {
+			Name         string `xml:"name,attr"`
+			LocalSheetID *int   `xml:"localSheetId,attr"`
+			Hidden       string `xml:"hidden,attr"`
+			RefersTo     string `xml:",chardata"`
+		} `xml:"definedNames>definedName"`
+	}
+	if err := readZipXML(files["xl/workbook.xml"], &wbXML); err != nil {
+		return nil, fmt.Errorf("failed to read workbook: %w", err)
+	}
+	targets, err := readRelationships(files["xl/_rels/workbook.xml.rels"], "xl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workbook relationships: %w", err)
+	}
+
+	wb := &workbook{
+		sheets: make([]workbookSheet, 0, len(wbXML.Sheets)),
+		epoch:  excelEpoch,
+	}
+	if wbXML.Pr.Date1904 == "1" || wbXML.Pr.Date1904 == "true" {
+		wb.epoch = date1904Epoch
+	}
+	for _, sheet := range wbXML.Sheets {
+		part := targets[sheet.RID]
+		wb.sheets = append(wb.sheets, workbookSheet{
+			name:   sheet.Name,
+			state:  sheet.State,
+			file:   files[part],
+			tables: readSheetTables(files, part),
+		})
+	}
+	for _, dn := range wbXML.DefinedNames {
+		scope := ScopeWorkbook
+		if id := dn.LocalSheetID; id != nil {
+			if *id < 0 || *id >= len(wb.sheets) {
+				continue
+			}
+			scope = wb.sheets[*id].name
+		}
+		wb.names = append(wb.names, newWorkbookName(dn.Name, scope, strings.TrimSpace(dn.RefersTo), xmlBool(dn.Hidden)))
+	}
+	if f := files["xl/sharedStrings.xml"]; f != nil {
+		if wb.sharedStrings, err = readSharedStrings(f); err != nil {
+			return nil, fmt.Errorf("failed to read shared strings: %w", err)
+		}
+	}
+	wb.styles = readCellStyles(files["xl/styles.xml"])
+	return wb, nil
+}
+
+// readRelationships maps relationship IDs to package part names. Targets are
+// relative to dir unless absolute within the package.
+func readRelationships(f *zip.File, dir string) (map[string]string, error) {
+	rels, err := readRelationshipList(f, dir)
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string, len(rels))
+	for _, rel := range rels {
+		targets[rel.id] = rel.target
+	}
+	return targets, nil
+}
+
+// relationship is one entry of a .rels part, with its target resolved to a
+// package part name.
+type relationship struct {
+	id     string
+	typ    string
+	target string
+}
+
+// readRelationshipList reads the relationships of a .rels part in order.
+// Targets are relative to dir unless absolute within the package.
+func readRelationshipList(f *zip.File, dir string) ([]relationship, error) {
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := readZipXML(f, &rels); err != nil {
+		return nil, err
+	}
+	out := make([]relationship, 0, len(rels.Relationships))
+	for _, rel := range rels.Relationships {
+		target := rel.Target
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(dir, target)
+		}
+		out = append(out, relationship{id: rel.ID, typ: rel.Type, target: target})
+	}
+	return out, nil
+}
+
+// readSharedStrings streams xl/sharedStrings.xml. Each <si> is either a plain
+// <t> or rich text runs whose <t> elements are concatenated; phonetic runs
+// (<rPh>) are left out.
+func readSharedStrings(f *zip.File) ([]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	out := make([]string, 0)
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "sst":
+		case "si":
+			text, err := readRichText(decoder, start)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, text)
+		default:
+			if err := decoder.Skip(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// readRichText returns the text of an <si> or <is> element whose start tag
+// has just been read, consuming the element.
+func readRichText(decoder *xml.Decoder, start xml.StartElement) (string, error) {
+	var b strings.Builder
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "rPh", "phoneticPr":
+				if err := decoder.Skip(); err != nil {
+					return "", err
+				}
+			case "t":
+				text, err := readCharData(decoder)
+				if err != nil {
+					return "", err
+				}
+				b.WriteString(text)
+			default:
+				depth++
+			}
+		case xml.EndElement:
+			if depth == 0 {
+				return b.String(), nil
+			}
+			depth--
+		}
+	}
+}
+
+// readCharData returns the text of the element whose start tag has just been
+// read, consuming the element.
+func readCharData(decoder *xml.Decoder) (string, error) {
+	var text string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			text += string(t)
+		case xml.StartElement:
+			if err := decoder.Skip(); err != nil {
+				return "", err
+			}
+		case xml.EndElement:
+			return text, nil
+		}
+	}
+}
+
+// readCellStyles reads xl/styles.xml and returns every cell style (cellXfs
+// entry), indexed by the style's s attribute. A missing or unreadable part
+// yields no styles.
+func readCellStyles(f *zip.File) []cellStyle {
+	var sheet struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		Fonts []struct {
+			Bold *struct {
+				Val string `xml:"val,attr"`
+			} `xml:"b"`
+		} `xml:"fonts>font"`
+		Borders []struct {
+			Bottom struct {
+				Style string `xml:"style,attr"`
+			} `xml:"bottom"`
+		} `xml:"borders>border"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+			FontID   int `xml:"fontId,attr"`
+			BorderID int `xml:"borderId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := readZipXML(f, &sheet); err != nil {
+		return nil
+	}
+
+	custom := make(map[int]string, len(sheet.NumFmts))
+	for _, nf := range sheet.NumFmts {
+		custom[nf.ID] = nf.Code
+	}
+	styles := make([]cellStyle, len(sheet.CellXfs))
+	for idx, xf := range sheet.CellXfs {
+		if code, ok := custom[xf.NumFmtID]; ok {
+			styles[idx].format = classifyFormatCode(code)
+		} else {
+			styles[idx].format = builtinFormatKinds[xf.NumFmtID]
+		}
+		if xf.FontID >= 0 && xf.FontID < len(sheet.Fonts) {
+			if b := sheet.Fonts[xf.FontID].Bold; b != nil && b.Val != "0" && b.Val != "false" {
+				styles[idx].header = true
+			}
+		}
+		if xf.BorderID >= 0 && xf.BorderID < len(sheet.Borders) {
+			if s := sheet.Borders[xf.BorderID].Bottom.Style; s != "" && s != "none" {
+				styles[idx].header = true
+			}
+		}
+	}
+	return styles
+}
+
+// style returns the cell style with index s, or the zero (General, plain)
+// style when there is none.
+func (wb *workbook) style(s int) cellStyle {
+	if s < 0 || s >= len(wb.styles) {
+		return cellStyle{}
+	}
+	return wb.styles[s]
+}
+
+// sheet returns the workbook entry of the named sheet.
+func (wb *workbook) sheet(name string) (workbookSheet, bool) {
+	for _, s := range wb.sheets {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return workbookSheet{}, false
+}
+
+// sheetNames returns the names of all sheets in workbook order.
+func (wb *workbook) sheetNames() []string {
+	names := make([]string, len(wb.sheets))
+	for idx, s := range wb.sheets {
+		names[idx] = s.name
+	}
+	return names
+}
+
+// errMissingPart reports a package part the workbook cannot be read
+// without: the package is damaged or is not a workbook at all. It is
+// deliberately not fs.ErrNotExist, which would pass for a missing file.
+var errMissingPart = errors.New("missing package part")
+
+func readZipXML(f *zip.File, v interface{}) error {
+	if f == nil {
+		return errMissingPart
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
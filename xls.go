@@ -0,0 +1,614 @@
+package excelinspect
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+)
+
+// cfbSignature starts every compound file, the container of .xls workbooks.
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// BIFF8 record types the reader understands. Everything else is skipped.
+const (
+	biffFormula     = 0x0006
+	biffEOF         = 0x000A
+	biffDateMode    = 0x0022
+	biffFilePass    = 0x002F
+	biffFont        = 0x0031
+	biffContinue    = 0x003C
+	biffColInfo     = 0x007D
+	biffBoundSheet  = 0x0085
+	biffMulRK       = 0x00BD
+	biffMulBlank    = 0x00BE
+	biffRString     = 0x00D6
+	biffXF          = 0x00E0
+	biffMergedCells = 0x00E5
+	biffSST         = 0x00FC
+	biffLabelSST    = 0x00FD
+	biffDimensions  = 0x0200
+	biffBlank       = 0x0201
+	biffNumber      = 0x0203
+	biffLabel       = 0x0204
+	biffBoolErr     = 0x0205
+	biffString      = 0x0207
+	biffRow         = 0x0208
+	biffArray       = 0x0221
+	biffTable       = 0x0236
+	biffRK          = 0x027E
+	biffFormat      = 0x041E
+	biffShrFmla     = 0x04BC
+	biffBOF         = 0x0809
+)
+
+// biffErrors maps BIFF error codes to the text Excel shows.
+var biffErrors = map[byte]string{
+	0x00: "#NULL!",
+	0x07: "#DIV/0!",
+	0x0F: "#VALUE!",
+	0x17: "#REF!",
+	0x1D: "#NAME?",
+	0x24: "#NUM!",
+	0x2A: "#N/A",
+}
+
+// readXLS reads the workbook globals of an .xls compound file, given its
+// root streams: the sheet list, shared strings, cell styles and date system.
+// The Workbook stream is kept in memory; its sheets are decoded when opened.
+func readXLS(streams map[string]*mscfb.File) (*workbook, error) {
+	stream := streams["Workbook"]
+	if stream == nil {
+		stream = streams["WORKBOOK"]
+	}
+	if stream == nil {
+		if streams["Book"] != nil {
+			return nil, errors.New("Excel 5.0/95 (BIFF5) workbooks are not supported")
+		}
+		return nil, errors.New("no Workbook stream in compound file")
+	}
+	data := make([]byte, stream.Size)
+	if _, err := io.ReadFull(stream, data); err != nil {
+		return nil, fmt.Errorf("failed to read Workbook stream: %w", err)
+	}
+	return readBIFFGlobals(data)
+}
+
+// biffRecords walks the records of a BIFF stream from an offset.
+type biffRecords struct {
+	data []byte
+	pos  int
+}
+
+// next returns the next record. ok is false at the end of the stream or at a
+// truncated record.
+func (b *biffRecords) next() (typ uint16, body []byte, ok bool) {
+	if b.pos+4 > len(b.data) {
+		return 0, nil, false
+	}
+	typ = binary.LittleEndian.Uint16(b.data[b.pos:])
+	size := le16(b.data[b.pos+2:])
+	start := b.pos + 4
+	if start+size > len(b.data) {
+		return 0, nil, false
+	}
+	b.pos = start + size
+	return typ, b.data[start : start+size], true
+}
+
+// continued returns body followed by the bodies of the CONTINUE records
+// after it, the segments a long record is split into.
+func (b *biffRecords) continued(body []byte) [][]byte {
+	segs := [][]byte{body}
+	for {
+		save := b.pos
+		typ, next, ok := b.next()
+		if !ok || typ != biffContinue {
+			b.pos = save
+			return segs
+		}
+		segs = append(segs, next)
+	}
+}
+
+// formulaString reads the string result of the FORMULA record just read,
+// from the STRING record that follows it. The SHRFMLA, ARRAY or TABLE record
+// holding the formula of a shared, array or data table formula may come
+// first and is skipped; any other record is left to be read next.
+func (b *biffRecords) formulaString() (string, bool) {
+	for {
+		save := b.pos
+		typ, body, ok := b.next()
+		switch {
+		case !ok:
+			return "", false
+		case typ == biffShrFmla || typ == biffArray || typ == biffTable:
+			continue
+		case typ == biffString:
+			s := &biffSegments{segs: b.continued(body)}
+			text, _ := s.unicodeString(false)
+			return text, true
+		}
+		b.pos = save
+		return "", false
+	}
+}
+
+// readBIFFGlobals reads the workbook globals substream at the start of a
+// BIFF8 Workbook stream.
+func readBIFFGlobals(data []byte) (*workbook, error) {
+	recs := &biffRecords{data: data}
+	typ, body, ok := recs.next()
+	if !ok || typ != biffBOF || len(body) < 4 {
+		return nil, errors.New("not a BIFF workbook stream")
+	}
+	if v := binary.LittleEndian.Uint16(body); v != 0x0600 {
+		return nil, fmt.Errorf("BIFF version %#04x is not supported, only BIFF8 (Excel 97 and later)", v)
+	}
+
+	wb := &workbook{epoch: excelEpoch, biff: data}
+	var (
+		bold    []bool
+		formats = make(map[int]string)
+		xfs     [][3]int // font, number format, bottom border
+	)
+	for {
+		typ, body, ok := recs.next()
+		if !ok {
+			return nil, errors.New("truncated workbook globals")
+		}
+		switch typ {
+		case biffEOF:
+			wb.styles = make([]cellStyle, len(xfs))
+			for idx, xf := range xfs {
+				if code, ok := formats[xf[1]]; ok {
+					wb.styles[idx].format = classifyFormatCode(code)
+				} else {
+					wb.styles[idx].format = builtinFormatKinds[xf[1]]
+				}
+				// Font index 4 is never written, so later fonts are one off.
+				font := xf[0]
+				if font > 4 {
+					font--
+				}
+				wb.styles[idx].header = valueAt(bold, font) || xf[2] != 0
+			}
+			return wb, nil
+		case biffFilePass:
+			// RC4 and XOR obfuscated workbooks are not decrypted.
+			return nil, fmt.Errorf("%w: encrypted .xls workbook", ErrUnsupportedEncryption)
+		case biffDateMode:
+			if len(body) >= 2 && le16(body) == 1 {
+				wb.epoch = date1904Epoch
+			}
+		case biffFont:
+			if len(body) >= 8 {
+				bold = append(bold, le16(body[6:]) >= 700)
+			}
+		case biffFormat:
+			if len(body) >= 2 {
+				s := &biffSegments{segs: [][]byte{body[2:]}}
+				if code, ok := s.unicodeString(false); ok {
+					formats[le16(body)] = code
+				}
+			}
+		case biffXF:
+			if len(body) >= 12 {
+				xfs = append(xfs, [3]int{
+					le16(body),
+					le16(body[2:]),
+					le16(body[10:]) >> 12,
+				})
+			}
+		case biffBoundSheet:
+			if len(body) < 8 {
+				continue
+			}
+			s := &biffSegments{segs: [][]byte{body[6:]}}
+			name, ok := s.unicodeString(true)
+			if !ok {
+				continue
+			}
+			sheet := workbookSheet{name: name, offset: -1}
+			switch body[4] & 0x03 {
+			case 1:
+				sheet.state = "hidden"
+			case 2:
+				sheet.state = "veryHidden"
+			}
+			if body[5] == 0 {
+				sheet.offset = int(binary.LittleEndian.Uint32(body))
+			}
+			wb.sheets = append(wb.sheets, sheet)
+		case biffSST:
+			wb.sharedStrings = readBIFFSharedStrings(recs.continued(body))
+		}
+	}
+}
+
+// readBIFFSharedStrings reads the shared string table from an SST record
+// and its CONTINUE records. A damaged table yields the strings read so far.
+func readBIFFSharedStrings(segs [][]byte) []string {
+	s := &biffSegments{segs: segs}
+	head, ok := s.bytes(8)
+	if !ok {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint32(head[4:]))
+	out := make([]string, 0, min(count, 1<<16))
+	for len(out) < count {
+		text, ok := s.unicodeString(false)
+		if !ok {
+			break
+		}
+		out = append(out, text)
+	}
+	return out
+}
+
+// biffSegments reads strings from a record split into segments by CONTINUE
+// records. A run of characters that crosses into the next segment resumes
+// there after a new option byte, which says whether it is stored as one or
+// two bytes per character.
+type biffSegments struct {
+	segs [][]byte
+	seg  int
+	pos  int
+}
+
+// bytes returns the next n bytes, which may span segments.
+func (s *biffSegments) bytes(n int) ([]byte, bool) {
+	var out []byte
+	for n > 0 {
+		if s.seg >= len(s.segs) {
+			return nil, false
+		}
+		cur := s.segs[s.seg]
+		if s.pos >= len(cur) {
+			s.seg++
+			s.pos = 0
+			continue
+		}
+		take := min(n, len(cur)-s.pos)
+		out = append(out, cur[s.pos:s.pos+take]...)
+		s.pos += take
+		n -= take
+	}
+	return out, true
+}
+
+// unicodeString reads an XLUnicodeRichExtendedString, or a
+// ShortXLUnicodeString (one-byte length, no rich text) when short is set.
+// Formatting runs and phonetic data are skipped.
+func (s *biffSegments) unicodeString(short bool) (string, bool) {
+	var count int
+	if short {
+		b, ok := s.bytes(1)
+		if !ok {
+			return "", false
+		}
+		count = int(b[0])
+	} else {
+		b, ok := s.bytes(2)
+		if !ok {
+			return "", false
+		}
+		count = le16(b)
+	}
+	opts, ok := s.bytes(1)
+	if !ok {
+		return "", false
+	}
+	var runs, ext int
+	if opts[0]&0x08 != 0 {
+		b, ok := s.bytes(2)
+		if !ok {
+			return "", false
+		}
+		runs = le16(b)
+	}
+	if opts[0]&0x04 != 0 {
+		b, ok := s.bytes(4)
+		if !ok {
+			return "", false
+		}
+		ext = int(binary.LittleEndian.Uint32(b))
+	}
+
+	wide := opts[0]&0x01 != 0
+	units := make([]uint16, 0, count)
+	for len(units) < count {
+		if s.seg >= len(s.segs) {
+			return "", false
+		}
+		cur := s.segs[s.seg]
+		if s.pos >= len(cur) {
+			s.seg++
+			s.pos = 0
+			if s.seg >= len(s.segs) || len(s.segs[s.seg]) == 0 {
+				return "", false
+			}
+			wide = s.segs[s.seg][0]&0x01 != 0
+			s.pos = 1
+			continue
+		}
+		if wide {
+			if s.pos+2 > len(cur) {
+				return "", false
+			}
+			units = append(units, binary.LittleEndian.Uint16(cur[s.pos:]))
+			s.pos += 2
+		} else {
+			units = append(units, uint16(cur[s.pos]))
+			s.pos++
+		}
+	}
+	if _, ok := s.bytes(4*runs + ext); !ok {
+		return "", false
+	}
+	return string(utf16.Decode(units)), true
+}
+
+// xlsSheetReader serves the rows of a worksheet decoded from the BIFF8
+// stream. A worksheet substream is small enough (at most 65,536 rows) that
+// it is decoded in full when opened.
+type xlsSheetReader struct {
+	rows       []sheetRow
+	pos        int
+	dimension  int
+	merges     []mergeRange
+	hiddenRows []lineSpan
+	hiddenCols []lineSpan
+}
+
+// openXLSSheet decodes the cells of a worksheet substream into rows.
+// Records after the worksheet's own EOF, and those of charts embedded in
+// it, are not read.
+func (wb *workbook) openXLSSheet(sheet workbookSheet) (*xlsSheetReader, error) {
+	r := &xlsSheetReader{}
+	if sheet.offset < 0 {
+		return r, nil
+	}
+	recs := &biffRecords{data: wb.biff, pos: sheet.offset}
+	typ, body, ok := recs.next()
+	if !ok || typ != biffBOF || len(body) < 4 {
+		return nil, fmt.Errorf("failed to open sheet %q: no BIFF substream at offset %d", sheet.name, sheet.offset)
+	}
+	if le16(body[2:]) != 0x0010 {
+		// A macro or dialog sheet: no cells to read.
+		return r, nil
+	}
+
+	rows := make(map[int]*sheetRow)
+	// cell returns row rw (0-based) and the style of XF index xf.
+	cell := func(rw, xf int) (*sheetRow, cellStyle) {
+		row := rows[rw]
+		if row == nil {
+			row = &sheetRow{Number: rw + 1}
+			rows[rw] = row
+		}
+		return row, wb.style(xf)
+	}
+	// set stores a cell, turning date-formatted numbers into dates.
+	set := func(row *sheetRow, col int, cs cellStyle, kind formatKind, value string, hasValue bool) {
+		if hasValue && (kind == formatDate || kind == formatTime || kind == formatDateTime) {
+			value = serialDateString(value, kind, wb.epoch)
+		}
+		row.setCell(col, value, hasValue, kind, cs.header)
+	}
+
+	depth := 0
+	for {
+		typ, body, ok := recs.next()
+		if !ok {
+			break
+		}
+		if typ == biffBOF {
+			depth++
+			continue
+		}
+		if typ == biffEOF {
+			if depth == 0 {
+				break
+			}
+			depth--
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		switch typ {
+		case biffDimensions:
+			if len(body) >= 8 {
+				r.dimension = int(binary.LittleEndian.Uint32(body[4:]))
+			}
+		case biffRow:
+			// fDyZero: the row is hidden.
+			if len(body) >= 14 && le16(body[12:])&0x0020 != 0 {
+				rw := le16(body) + 1
+				r.hiddenRows = addSpan(r.hiddenRows, rw, rw)
+			}
+		case biffColInfo:
+			if len(body) >= 10 && le16(body[8:])&0x0001 != 0 {
+				// The last column may be given as 256, one past the last.
+				r.hiddenCols = addSpan(r.hiddenCols, le16(body), min(le16(body[2:]), 255))
+			}
+		case biffLabelSST:
+			if len(body) >= 10 {
+				row, cs := cell(le16(body), le16(body[4:]))
+				idx := int(binary.LittleEndian.Uint32(body[6:]))
+				set(row, le16(body[2:]), cs, formatGeneral, valueAt(wb.sharedStrings, idx), true)
+			}
+		case biffLabel, biffRString:
+			if len(body) >= 9 {
+				row, cs := cell(le16(body), le16(body[4:]))
+				s := &biffSegments{segs: [][]byte{body[6:]}}
+				text, _ := s.unicodeString(false)
+				set(row, le16(body[2:]), cs, formatGeneral, text, true)
+			}
+		case biffNumber:
+			if len(body) >= 14 {
+				row, cs := cell(le16(body), le16(body[4:]))
+				v := math.Float64frombits(binary.LittleEndian.Uint64(body[6:]))
+				set(row, le16(body[2:]), cs, cs.format, biffNumberString(v), true)
+			}
+		case biffRK:
+			if len(body) >= 10 {
+				row, cs := cell(le16(body), le16(body[4:]))
+				v := rkNumber(binary.LittleEndian.Uint32(body[6:]))
+				set(row, le16(body[2:]), cs, cs.format, biffNumberString(v), true)
+			}
+		case biffMulRK:
+			if len(body) < 6 {
+				continue
+			}
+			rw, first := le16(body), le16(body[2:])
+			for idx, off := 0, 4; off+6 <= len(body)-2; idx, off = idx+1, off+6 {
+				row, cs := cell(rw, le16(body[off:]))
+				v := rkNumber(binary.LittleEndian.Uint32(body[off+2:]))
+				set(row, first+idx, cs, cs.format, biffNumberString(v), true)
+			}
+		case biffBlank:
+			if len(body) >= 6 {
+				row, cs := cell(le16(body), le16(body[4:]))
+				set(row, le16(body[2:]), cs, cs.format, "", false)
+			}
+		case biffMulBlank:
+			if len(body) < 6 {
+				continue
+			}
+			rw, first := le16(body), le16(body[2:])
+			for idx, off := 0, 4; off+2 <= len(body)-2; idx, off = idx+1, off+2 {
+				row, cs := cell(rw, le16(body[off:]))
+				set(row, first+idx, cs, cs.format, "", false)
+			}
+		case biffBoolErr:
+			if len(body) >= 8 {
+				row, cs := cell(le16(body), le16(body[4:]))
+				if body[7] == 0 {
+					set(row, le16(body[2:]), cs, formatBoolean, strconv.Itoa(int(body[6]&1)), true)
+				} else {
+					set(row, le16(body[2:]), cs, formatError, biffErrors[body[6]], true)
+				}
+			}
+		case biffFormula:
+			if len(body) < 14 {
+				continue
+			}
+			row, cs := cell(le16(body), le16(body[4:]))
+			col := le16(body[2:])
+			// The formula itself is stored compiled; only its presence is
+			// reported.
+			row.setFormula(col, opaqueFormula)
+			if le16(body[12:]) != 0xFFFF {
+				v := math.Float64frombits(binary.LittleEndian.Uint64(body[6:]))
+				set(row, col, cs, cs.format, biffNumberString(v), true)
+				continue
+			}
+			switch body[6] {
+			case 0:
+				if text, ok := recs.formulaString(); ok {
+					set(row, col, cs, formatGeneral, text, true)
+				}
+			case 1:
+				set(row, col, cs, formatBoolean, strconv.Itoa(int(body[8]&1)), true)
+			case 2:
+				set(row, col, cs, formatError, biffErrors[body[8]], true)
+			case 3:
+				set(row, col, cs, formatGeneral, "", true)
+			}
+		case biffMergedCells:
+			if len(body) < 2 {
+				continue
+			}
+			count := le16(body)
+			for idx := 0; idx < count && 2+idx*8+8 <= len(body); idx++ {
+				ref := body[2+idx*8:]
+				r.merges = append(r.merges, mergeRange{
+					top:    le16(ref),
+					bottom: le16(ref[2:]),
+					left:   le16(ref[4:]),
+					right:  le16(ref[6:]),
+				})
+			}
+		}
+	}
+
+	r.rows = make([]sheetRow, 0, len(rows))
+	for _, row := range rows {
+		r.rows = append(r.rows, *row)
+	}
+	slices.SortFunc(r.rows, func(a, b sheetRow) int { return a.Number - b.Number })
+	return r, nil
+}
+
+// le16 reads the little-endian uint16 at the start of b.
+func le16(b []byte) int {
+	return int(binary.LittleEndian.Uint16(b))
+}
+
+// rkNumber decodes an RK value: a 30-bit integer or the high 30 bits of a
+// float64, either optionally scaled by 1/100.
+func rkNumber(rk uint32) float64 {
+	var v float64
+	if rk&0x02 != 0 {
+		v = float64(int32(rk) >> 2)
+	} else {
+		v = math.Float64frombits(uint64(rk&^0x03) << 32)
+	}
+	if rk&0x01 != 0 {
+		v /= 100
+	}
+	return v
+}
+
+// biffNumberString formats a cell's number the way .xlsx files store it:
+// plain decimal notation, with an exponent only for very large or small
+// magnitudes.
+func biffNumberString(v float64) string {
+	if a := math.Abs(v); a != 0 && (a < 1e-6 || a >= 1e21) {
+		return strconv.FormatFloat(v, 'E', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (r *xlsSheetReader) next() (sheetRow, bool, error) {
+	if r.pos >= len(r.rows) {
+		return sheetRow{}, false, nil
+	}
+	r.pos++
+	return r.rows[r.pos-1], true, nil
+}
+
+// dimensionRows returns the row count of the worksheet's DIMENSIONS record,
+// which is also the number of its last row.
+func (r *xlsSheetReader) dimensionRows() (int, bool) {
+	return r.dimension, r.dimension > 0
+}
+
+func (r *xlsSheetReader) finish(ctx context.Context) error {
+	r.pos = len(r.rows)
+	return ctx.Err()
+}
+
+func (r *xlsSheetReader) lastRow() int {
+	if r.pos == 0 {
+		return 0
+	}
+	return r.rows[r.pos-1].Number
+}
+
+func (r *xlsSheetReader) mergeRanges() []mergeRange { return r.merges }
+
+func (r *xlsSheetReader) hiddenLines() (rows, cols []lineSpan) {
+	return r.hiddenRows, r.hiddenCols
+}
+
+func (r *xlsSheetReader) close() {}
@@ -0,0 +1,142 @@
+package excelinspect
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// biffRecord encodes one BIFF record of type typ with the concatenated body.
+func biffRecord(typ uint16, body ...[]byte) []byte {
+	var data []byte
+	for _, b := range body {
+		data = append(data, b...)
+	}
+	out := binary.LittleEndian.AppendUint16(nil, typ)
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(data)))
+	return append(out, data...)
+}
+
+func u16(vs ...int) []byte {
+	var out []byte
+	for _, v := range vs {
+		out = binary.LittleEndian.AppendUint16(out, uint16(v))
+	}
+	return out
+}
+
+// biffText encodes s as an uncompressed XLUnicodeString with an 8-bit
+// (short) or 16-bit length.
+func biffText(s string, short bool) []byte {
+	var out []byte
+	if short {
+		out = []byte{byte(len(s))}
+	} else {
+		out = u16(len(s))
+	}
+	return append(append(out, 0), s...)
+}
+
+// biffFormulaCell encodes a FORMULA record at row rw, column col. A nil
+// number stands for a string result, given by a following STRING record.
+func biffFormulaCell(rw, col int, number *float64) []byte {
+	result := make([]byte, 8)
+	if number != nil {
+		binary.LittleEndian.PutUint64(result, math.Float64bits(*number))
+	} else {
+		result[6], result[7] = 0xFF, 0xFF
+	}
+	return biffRecord(biffFormula, u16(rw, col, 0), result, u16(0), make([]byte, 4), u16(0))
+}
+
+// biffWorkbook returns a Workbook stream with globals records and one
+// worksheet holding cells.
+func biffWorkbook(globals []byte, cells ...[]byte) []byte {
+	bof := func(kind int) []byte {
+		return biffRecord(biffBOF, u16(0x0600, kind), make([]byte, 12))
+	}
+	eof := biffRecord(biffEOF)
+	sheetName := biffText("Data", true)
+	head := append(bof(0x0005), globals...)
+	offset := len(head) + 4 + 6 + len(sheetName) + len(eof)
+	stream := append(head, biffRecord(biffBoundSheet, binary.LittleEndian.AppendUint32(nil, uint32(offset)), []byte{0, 0}, sheetName)...)
+	stream = append(stream, eof...)
+	stream = append(stream, bof(0x0010)...)
+	for _, c := range cells {
+		stream = append(stream, c...)
+	}
+	return append(stream, eof...)
+}
+
+func TestXLSFormulaResults(t *testing.T) {
+	num := 42.5
+	stringResult := func(s string) []byte {
+		return biffRecord(biffString, biffText(s, false))
+	}
+	tests := []struct {
+		name  string
+		cells [][]byte
+		want  []string
+	}{
+		{
+			name:  "number",
+			cells: [][]byte{biffFormulaCell(0, 0, &num)},
+			want:  []string{"42.5"},
+		},
+		{
+			name:  "string",
+			cells: [][]byte{biffFormulaCell(0, 0, nil), stringResult("plain")},
+			want:  []string{"plain"},
+		},
+		{
+			name:  "shared formula string",
+			cells: [][]byte{biffFormulaCell(0, 0, nil), biffRecord(biffShrFmla, make([]byte, 10)), stringResult("shared")},
+			want:  []string{"shared"},
+		},
+		{
+			name:  "array formula string",
+			cells: [][]byte{biffFormulaCell(0, 0, nil), biffRecord(biffArray, make([]byte, 14)), stringResult("array")},
+			want:  []string{"array"},
+		},
+		{
+			name: "missing string keeps the next cell",
+			cells: [][]byte{
+				biffFormulaCell(0, 0, nil),
+				biffRecord(biffNumber, u16(0, 1, 0), binary.LittleEndian.AppendUint64(nil, math.Float64bits(7))),
+			},
+			want: []string{"", "7"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wb, err := readBIFFGlobals(biffWorkbook(nil, tt.cells...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := wb.openXLSSheet(wb.sheets[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			row, ok, err := r.next()
+			if err != nil || !ok {
+				t.Fatalf("next() = %v, %v", ok, err)
+			}
+			for col, want := range tt.want {
+				if got := valueAt(row.Values, col); got != want {
+					t.Errorf("column %d = %q, want %q", col, got, want)
+				}
+			}
+			if valueAt(row.formulas, 0) == nil {
+				t.Error("formula cell not marked as a formula")
+			}
+		})
+	}
+}
+
+func TestXLSEncrypted(t *testing.T) {
+	_, err := readBIFFGlobals(biffWorkbook(biffRecord(biffFilePass, u16(1), make([]byte, 52))))
+	if !errors.Is(err, ErrUnsupportedEncryption) {
+		t.Fatalf("err = %v, want ErrUnsupportedEncryption", err)
+	}
+}